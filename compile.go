@@ -1,4 +1,555 @@
 package vikyscript
 
-func (r *Recognizer) translate() {
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxShufflePermutations is the largest number of permutations of the blocks
+// of a # operator that are translated into an alternation, as many as the ones
+// of five blocks. Operators nested in the blocks are copied into every
+// permutation, so their permutations multiply those of the operator holding
+// them. Bigger operators are translated into a repetition of as many blocks
+// as they hold,
+// which also matches a block more than once, so the words it matched are
+// assigned to the blocks again once the regular expression matched. Only the
+// words chosen by the regular expression are tried: a text is rejected if
+// they cannot be assigned, even if splitting it differently with the blocks
+// around the operator would allow it.
+const maxShufflePermutations = 120
+
+// literalGroup is the name of the groups of the words and unnamed lists.
+const literalGroup = "_literal"
+
+// ignoreExpr is the regular expression of the * operator.
+const ignoreExpr = `(?: \S+)*?`
+
+// paramExpr is the regular expression of the value of a parameter.
+const paramExpr = `\S+(?: \S+)*?`
+
+// command is a single parsed command translated into a regular expression.
+type command struct {
+	tree   *Tree
+	re     *pattern        // Only matches values of the right type for typed parameters.
+	loose  *pattern        // Matches any value for typed parameters; nil if the same as re.
+	params []param         // The parameters, in order of appearance.
+	bags   map[string]*bag // The big # operators being translated, by name of their group.
+	nbags  int             // The number of big # operators translated.
+	perms  int             // The permutations of the operators nested in the block being translated.
+	typed  bool            // Whether the translation uses the expressions of typed parameters.
+
+	tolerance int             // The largest edit distance of a misspelled word; 0 if words must match exactly.
+	phonetic  bool            // Whether words that sound like the words of a list match them.
+	words     map[string]bool // The words of the command and of its lists.
+	listWords map[string]bool // The words of the lists of the command.
+}
+
+// param describes a parameter of a command.
+type param struct {
+	name   string
+	typ    string            // Empty for named lists and untyped parameters.
+	list   bool              // Whether the parameter is a named list.
+	def    string            // The value of the parameter when it is missing.
+	values map[string]string // The values of the synonyms of a named list, by lowercase synonym.
+}
+
+// pattern is a compiled regular expression, and the big # operators it holds.
+type pattern struct {
+	re   *regexp.Regexp
+	bags map[string]*bag // By name of their group.
+}
+
+// bag is a big # operator. Its group holds the repetition of its blocks.
+type bag struct {
+	blocks []*pattern // The blocks, each matching a whole text.
+	gaps   bool       // Whether words can be ignored between the blocks.
+	groups int        // The number of groups nested in the group of the operator.
+}
+
+// compile translates the tree into a regular expression.
+func compile(tree *Tree) (*command, error) {
+	c := &command{tree: tree, words: make(map[string]bool), listWords: make(map[string]bool)}
+	Walk(tree.Root, func(n Node) bool {
+		switch n := n.(type) {
+		case *TextNode:
+			c.words[strings.ToLower(string(n.Text))] = true
+		case *ParamNode:
+			c.params = append(c.params, param{name: n.Name, typ: n.Typ, def: n.Default})
+		case *NamedListNode:
+			if n.Name != "" {
+				p := param{name: n.Name, list: true, values: make(map[string]string)}
+				for i, w := range n.Words {
+					// The first synonym matches if the same one is repeated.
+					if w = strings.ToLower(w); p.values[w] == "" {
+						p.values[w] = n.Value(i)
+					}
+				}
+				c.params = append(c.params, p)
+			}
+			for _, w := range n.Words {
+				for _, f := range strings.Fields(strings.ToLower(w)) {
+					c.words[f] = true
+					c.listWords[f] = true
+				}
+			}
+		}
+		return true
+	})
+	seen := make(map[string]bool)
+	for _, p := range c.params {
+		if seen[p.name] {
+			return nil, fmt.Errorf("command %q: duplicate parameter %q", tree.Name, p.name)
+		}
+		seen[p.name] = true
+		convert, ok := converters[p.typ]
+		if !ok {
+			return nil, fmt.Errorf("command %q: unknown type %q for parameter %q", tree.Name, p.typ, p.name)
+		}
+		if p.def == "" {
+			continue
+		}
+		if _, err := convert(p.def, time.Now()); err != nil {
+			return nil, fmt.Errorf("command %q: invalid default value %q for parameter %q: %v", tree.Name, p.def, p.name, err)
+		}
+	}
+	var err error
+	if c.re, err = c.pattern(true); err != nil {
+		return nil, err
+	}
+	loose, err := c.pattern(false)
+	if err != nil {
+		return nil, err
+	}
+	if loose.re.String() != c.re.re.String() {
+		c.loose = loose
+	}
+	return c, nil
+}
+
+// pattern returns the pattern matching the whole command.
+func (c *command) pattern(typed bool) (*pattern, error) {
+	c.typed = typed
+	c.bags, c.perms = make(map[string]*bag), 1
+	b := new(bytes.Buffer)
+	b.WriteString("^")
+	if err := c.translate(b, c.tree.Root); err != nil {
+		return nil, err
+	}
+	b.WriteString("$")
+	return c.compilePattern(b.String())
+}
+
+// compilePattern compiles expr into a pattern holding the big # operators in
+// c.bags.
+func (c *command) compilePattern(expr string) (*pattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("command %q: %v", c.tree.Name, err)
+	}
+	return &pattern{re: re, bags: c.bags}, nil
+}
+
+// translate writes the regular expression matching n to b.
+// Every block consumes the single space that precedes it, so the text to be
+// matched must be normalized first.
+func (c *command) translate(b *bytes.Buffer, n Node) error {
+	switch n := n.(type) {
+	case *ListNode:
+		for _, elem := range n.Nodes {
+			if err := c.translate(b, elem); err != nil {
+				return err
+			}
+		}
+	case *TextNode:
+		fmt.Fprintf(b, " (?P<%s>%s)", literalGroup, regexp.QuoteMeta(strings.ToLower(string(n.Text))))
+	case *IgnoreNode:
+		b.WriteString(ignoreExpr)
+	case *OptionalNode:
+		inner := n.Node
+		if p, ok := inner.(*ParenNode); ok {
+			// Avoid a redundant group.
+			inner = p.List
+		}
+		b.WriteString("(?:")
+		if err := c.translate(b, inner); err != nil {
+			return err
+		}
+		b.WriteString(")?")
+	case *ParenNode:
+		b.WriteString("(?:")
+		if err := c.translate(b, n.List); err != nil {
+			return err
+		}
+		b.WriteString(")")
+	case *ShuffleNode:
+		return c.translateShuffle(b, n)
+	case *NamedListNode:
+		words := make([]string, len(n.Words))
+		for i, w := range n.Words {
+			words[i] = regexp.QuoteMeta(strings.ToLower(w))
+		}
+		if n.Name == "" {
+			fmt.Fprintf(b, " (?P<%s>%s)", literalGroup, strings.Join(words, "|"))
+		} else {
+			fmt.Fprintf(b, " (?P<%s>%s)", n.Name, strings.Join(words, "|"))
+		}
+	case *ParamNode:
+		expr := paramExpr
+		if e, ok := typeExprs[n.Typ]; ok && c.typed {
+			expr = e
+		}
+		fmt.Fprintf(b, " (?P<%s>%s)", n.Name, expr)
+	default:
+		return fmt.Errorf("command %q: unexpected node %s", c.tree.Name, n)
+	}
+	return nil
+}
+
+// translateShuffle writes the regular expression matching the blocks of n in
+// any order. Since ignored words can be anywhere in the block, * operators are
+// not permuted: ignored words are allowed between all the other blocks.
+func (c *command) translateShuffle(b *bytes.Buffer, n *ShuffleNode) error {
+	var blocks []string
+	var bags []map[string]*bag // The operators nested in every block.
+	sep := ""
+	outer, outerPerms := c.bags, c.perms
+	nested := 1 // The largest number of permutations nested in a block.
+	for _, elem := range n.List.Nodes {
+		if elem.Type() == NodeIgnore {
+			sep = ignoreExpr
+			continue
+		}
+		eb := new(bytes.Buffer)
+		c.bags, c.perms = make(map[string]*bag), 1
+		if err := c.translate(eb, elem); err != nil {
+			return err
+		}
+		blocks = append(blocks, eb.String())
+		bags = append(bags, c.bags)
+		if c.perms > nested {
+			nested = c.perms
+		}
+	}
+	c.bags = outer
+	perms := nested
+	defer func() {
+		if c.perms = outerPerms; perms > c.perms {
+			c.perms = perms
+		}
+	}()
+	for i := 2; i <= len(blocks) && perms <= maxShufflePermutations; i++ {
+		perms *= i
+	}
+	if perms > maxShufflePermutations {
+		// Every block is copied once.
+		perms = nested
+		bg := &bag{gaps: sep != ""}
+		// The leftmost alternatives are preferred, so blocks that can match
+		// any word are tried last to keep them from swallowing the others.
+		var alts, variable []string
+		for i, block := range blocks {
+			c.bags = bags[i]
+			p, err := c.compilePattern("^(?:" + block + ")$")
+			if err != nil {
+				return err
+			}
+			bg.blocks = append(bg.blocks, p)
+			if strings.Contains(block, paramExpr) || strings.Contains(block, ignoreExpr) {
+				variable = append(variable, block)
+			} else {
+				alts = append(alts, block)
+			}
+		}
+		c.bags = outer
+		alts = append(alts, variable...)
+		expr := fmt.Sprintf("(?:%s(?:%s)){%d}%s", sep, strings.Join(alts, "|"), len(blocks), sep)
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("command %q: %v", c.tree.Name, err)
+		}
+		bg.groups = re.NumSubexp()
+		name := fmt.Sprintf("_bag%d", c.nbags)
+		c.nbags++
+		c.bags[name] = bg
+		fmt.Fprintf(b, "(?P<%s>%s)", name, expr)
+		return nil
+	}
+	// The operators nested in the blocks are matched by the whole expression.
+	for _, blockBags := range bags {
+		for name, bg := range blockBags {
+			c.bags[name] = bg
+		}
+	}
+	b.WriteString("(?:")
+	for i, perm := range permutations(len(blocks)) {
+		if i > 0 {
+			b.WriteString("|")
+		}
+		b.WriteString(sep)
+		for _, j := range perm {
+			b.WriteString(blocks[j] + sep)
+		}
+	}
+	b.WriteString(")")
+	return nil
+}
+
+// permutations returns all the permutations of the integers in [0,n), the
+// identity first.
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var perms [][]int
+	for _, p := range permutations(n - 1) {
+		// Insert n-1 in every position, starting from the last one.
+		for i := len(p); i >= 0; i-- {
+			perm := make([]int, 0, n)
+			perm = append(perm, p[:i]...)
+			perm = append(perm, n-1)
+			perms = append(perms, append(perm, p[i:]...))
+		}
+	}
+	return perms
+}
+
+// Name returns the name of the command.
+func (c *command) Name() string {
+	return c.tree.Name
+}
+
+// Match matches text against the command. Matching is case insensitive.
+func (c *command) Match(text string, now time.Time) *Result {
+	return c.match(normalize(text), now)
+}
+
+// Signature returns the names and the types of the parameters of the command.
+func (c *command) Signature() (names, types []string) {
+	for _, p := range c.params {
+		names = append(names, p.name)
+		types = append(types, p.typ)
+	}
+	return names, types
+}
+
+// match matches the normalized text against the command. It returns nil if
+// the text does not match. Relative values of parameters are resolved with
+// respect to now. Values of the right type for typed parameters are
+// preferred, but any value is accepted and its index is reported among the
+// type errors of the result.
+// If the text does not match and the command has a tolerance or matches
+// words phonetically, the misspelled words of the text are fixed and matching
+// is attempted again.
+func (c *command) match(text string, now time.Time) *Result {
+	res := c.matchFixed(text, text, now)
+	if res == nil && (c.tolerance > 0 || c.phonetic) {
+		if fixed := c.fix(text); fixed != text {
+			res = c.matchFixed(text, fixed, now)
+		}
+	}
+	return res
+}
+
+// matchFixed matches fixed, the normalized text with some words replaced by
+// words of the command, against the command. Named lists are passed the value
+// of the synonym that matched in fixed, since synonyms are words of the
+// command, while parameters are passed the words of text.
+// Words replaced in the literal part of the match count half in the score.
+// The words matched neither by the words and lists of the command nor by its
+// parameters are the ignored ones.
+func (c *command) matchFixed(text, fixed string, now time.Time) *Result {
+	m := c.re.submatch(fixed, span{0, len(fixed)})
+	if m == nil && c.loose != nil {
+		m = c.loose.submatch(fixed, span{0, len(fixed)})
+	}
+	if m == nil {
+		return nil
+	}
+	words, fixedWords := strings.Fields(text), strings.Fields(fixed)
+	literal := make([]bool, len(words))
+	markLiteral := func(sp span) {
+		start, end := sp.words(fixed)
+		for i := start; i < end; i++ {
+			literal[i] = true
+		}
+	}
+	for _, sp := range m.literals {
+		markLiteral(sp)
+	}
+	res := &Result{Command: c.tree.Name}
+	paramWords := 0
+	for i, p := range c.params {
+		var value string
+		sp, ok := m.groups[p.name]
+		if ok && p.list {
+			markLiteral(sp)
+			value = p.values[fixed[sp.start:sp.end]]
+		} else if ok {
+			start, end := sp.words(fixed)
+			paramWords += end - start
+			value = strings.Join(words[start:end], " ")
+			v, err := converters[p.typ](value, now)
+			if err != nil {
+				res.TypeErrors = append(res.TypeErrors, i)
+			} else {
+				value = v
+			}
+		} else if p.def != "" {
+			// The default value was checked by compile.
+			value, _ = converters[p.typ](p.def, now)
+		}
+		res.Params = append(res.Params, Param{Name: p.name, Value: value})
+	}
+	replaced := 0
+	for i, l := range literal {
+		if l {
+			res.Literal++
+			if words[i] != fixedWords[i] {
+				replaced++
+			}
+		}
+	}
+	res.Ignored = len(words) - res.Literal - paramWords
+	if len(words) > 0 {
+		res.Score = (float64(res.Literal) - float64(replaced)/2) / float64(len(words))
+	}
+	return res
+}
+
+// span is the position of a group in the text.
+type span struct {
+	start, end int
+}
+
+// words returns the indexes of the first word of the span in text, and of the
+// one following its last word.
+func (sp span) words(text string) (start, end int) {
+	// Groups do not include the space preceding their first word.
+	s := sp.start
+	if s < sp.end {
+		s--
+	}
+	start = strings.Count(text[:s], " ")
+	return start, start + strings.Count(text[s:sp.end], " ")
+}
+
+// submatches holds the positions of the groups of a match.
+type submatches struct {
+	groups   map[string]span // The groups of parameters and named lists, by name.
+	literals []span          // The groups of the words and unnamed lists.
+}
+
+// submatch matches the part of text in sp against p, and returns the groups
+// that matched, or nil if it does not match.
+func (p *pattern) submatch(text string, sp span) *submatches {
+	loc := p.re.FindStringSubmatchIndex(text[sp.start:sp.end])
+	if loc == nil {
+		return nil
+	}
+	m := &submatches{groups: make(map[string]span)}
+	names := p.re.SubexpNames()
+	for i := 1; i < len(names); i++ {
+		if loc[2*i] < 0 {
+			continue
+		}
+		gsp := span{sp.start + loc[2*i], sp.start + loc[2*i+1]}
+		if bg, ok := p.bags[names[i]]; ok {
+			// The groups nested in the operator only hold the last
+			// repetition, so they are replaced by the ones of the blocks.
+			a := bg.assign(text, gsp)
+			if a == nil {
+				return nil
+			}
+			m.merge(a)
+			i += bg.groups
+			continue
+		}
+		switch names[i] {
+		case "":
+		case literalGroup:
+			m.literals = append(m.literals, gsp)
+		default:
+			if _, ok := m.groups[names[i]]; !ok {
+				m.groups[names[i]] = gsp
+			}
+		}
+	}
+	return m
+}
+
+// merge adds the groups of a to m.
+func (m *submatches) merge(a *submatches) {
+	for name, sp := range a.groups {
+		if _, ok := m.groups[name]; !ok {
+			m.groups[name] = sp
+		}
+	}
+	m.literals = append(m.literals, a.literals...)
+}
+
+// assign assigns the words of text in sp, that the repetition of the blocks
+// of the operator matched, to the blocks, so that every block is used exactly
+// once. It returns the groups the blocks matched, or nil if the words cannot
+// be assigned. Shorter gaps and blocks are tried first, in order.
+func (bg *bag) assign(text string, sp span) *submatches {
+	// The blocks start and end at the spaces preceding the words.
+	var bounds []int
+	for i := sp.start; i < sp.end; i++ {
+		if text[i] == ' ' {
+			bounds = append(bounds, i)
+		}
+	}
+	bounds = append(bounds, sp.end)
+	all := 1<<uint(len(bg.blocks)) - 1
+	failed := make(map[[2]int]bool)
+	var solve func(k, used int) *submatches
+	solve = func(k, used int) *submatches {
+		if used == all {
+			if !bg.gaps && k != len(bounds)-1 {
+				return nil
+			}
+			return &submatches{groups: make(map[string]span)}
+		}
+		if failed[[2]int{k, used}] {
+			return nil
+		}
+		for g := k; g < len(bounds) && (g == k || bg.gaps); g++ {
+			for i, block := range bg.blocks {
+				if used&(1<<uint(i)) != 0 {
+					continue
+				}
+				for e := g; e < len(bounds); e++ {
+					bm := block.submatch(text, span{bounds[g], bounds[e]})
+					if bm == nil {
+						continue
+					}
+					m := solve(e, used|1<<uint(i))
+					if m == nil {
+						continue
+					}
+					m.merge(bm)
+					return m
+				}
+			}
+		}
+		failed[[2]int{k, used}] = true
+		return nil
+	}
+	return solve(0, 0)
+}
+
+// normalize lowercases text and collapses its whitespace so that it can be
+// matched by a compiled command: every word is preceded by a single space.
+// Punctuation surrounding words is discarded.
+func normalize(text string) string {
+	b := new(bytes.Buffer)
+	for _, w := range strings.Fields(strings.ToLower(text)) {
+		if w = strings.Trim(w, `.,;:!?"`); w != "" {
+			b.WriteString(" " + w)
+		}
+	}
+	return b.String()
 }
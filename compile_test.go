@@ -0,0 +1,131 @@
+package vikyscript
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var translateTests = []struct {
+	name, input, output string
+}{
+	{"word", "command:foo bar", `^ (?P<_literal>foo) (?P<_literal>bar)$`},
+	{"ignore", "command:foo * bar", `^ (?P<_literal>foo)(?: \S+)*? (?P<_literal>bar)$`},
+	{"optional", "command:foo ?bar ?(baz *)", `^ (?P<_literal>foo)(?: (?P<_literal>bar))?(?: (?P<_literal>baz)(?: \S+)*?)?$`},
+	{"list", "command:[foo,put together] bar", `^ (?P<_literal>foo|put together) (?P<_literal>bar)$`},
+	{"namedlist", "command:[which:Foo,bar]", `^ (?P<which>foo|bar)$`},
+	{"param", "command:foo {what} at {when:date}", `^ (?P<_literal>foo) (?P<what>\S+(?: \S+)*?) (?P<_literal>at) (?P<when>\S+(?: \S+)*?)$`},
+}
+
+func TestTranslate(t *testing.T) {
+	for _, tt := range translateTests {
+		treeSet, err := Parse(tt.name, tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		c, err := compile(treeSet["command"])
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got := c.re.re.String(); got != tt.output {
+			t.Errorf("%s: got\n\t%s\nexpected\n\t%s", tt.name, got, tt.output)
+		}
+	}
+}
+
+const shoppingCommand = "shoppingList: [action:add,remove,delete] {what} [to,from] {when:date} * shopping list"
+
+var compileMatchTests = []struct {
+	source, text string
+	match        bool
+}{
+	{volumeCommand, "Increase volume", true},
+	{volumeCommand, "Decrease  volume.", true},
+	{volumeCommand, "Increase the volume of ten percent", true},
+	{volumeCommand, "Lower the volume of one hundred", true},
+	{volumeCommand, "Lower the volumes", false},
+	{volumeCommand, "Raise the volume", false},
+	{volumeCommand, "Volume increase twenty", true},
+	{volumeCommand, "Please, volume up: increase it of twenty percent", true},
+	{"command: #(a b c d e f)", "a b c d e f", true},
+	{"command: #(a b c d e f)", "f e d c b a", true},
+	{"command: #(a b c d e f)", "a b c d e", false},
+	{"command: #(a b c d e f)", "a a b c d e", false},
+	{"command: #(a b c d e f) * g", "b a c d f e then g", true},
+	{"command: x ?(#(a b c d e f))", "x", true},
+	{"command: x ?(#(a b c d e f))", "x a a a a a a", false},
+	{"command: go #(a b c d e [l:a,z])", "go a a b c d e", true},
+	{"command: go #(a b c d e [l:a,z])", "go z a b c d e", true},
+	{"command: go #(a b c d e [l:a,z])", "go a b c d e e", false},
+	{"command: #(a b c d e #(f g h i j k))", "k j i h g f a b c d e", true},
+	{"command: #(a b c d e #(f g h i j k))", "k j i h g g a b c d e", false},
+	{"command: go #(a b c d #(e f g h i))", "go b i h g f e a d c", true},
+	{"command: go #(a b c d #(e f g h i))", "go b i h g f a e d c", false},
+	{"command: go #(a b c d #(e f g h #(j k l m n)))", "go d n m l k j h g f e c b a", true},
+	{"command: go #(a b c d #(e f g h #(j k l m n)))", "go d n m l k h j g f e c b a", false},
+	{shoppingCommand, "Add potatoes to tomorrow's shopping list", true},
+	{shoppingCommand, "Remove garlic from Wednesday's shopping list", true},
+	{shoppingCommand, "potatoes remove from Wednesday's shopping list", false},
+}
+
+func TestCompileMatch(t *testing.T) {
+	for _, tt := range compileMatchTests {
+		r := NewRecognizer(tt.source)
+		if err := r.Compile(); err != nil {
+			t.Errorf("unexpected error compiling %q: %v", tt.source, err)
+			continue
+		}
+		if got := r.matchers[0].Match(tt.text, time.Now()) != nil; got != tt.match {
+			t.Errorf("%q: got match %v expected %v", tt.text, got, tt.match)
+		}
+	}
+}
+
+var matchCountTests = []struct {
+	source, text     string
+	literal, ignored int
+}{
+	{"command: foo * bar", "foo x y bar", 2, 2},
+	{"command: foo {x} * bar", "foo x y bar", 2, 1},
+	{"command: go #(a b c d e * f)", "go a x b c d e f", 7, 1},
+	{"command: go #(a b c d e * f)", "go x f y e d c b a z", 7, 3},
+	{"command: go #(a b c d e f) * {x} now", "go f e d c b a x y z now", 8, 0},
+}
+
+func TestMatchCount(t *testing.T) {
+	for _, tt := range matchCountTests {
+		r := NewRecognizer(tt.source)
+		if err := r.Compile(); err != nil {
+			t.Errorf("unexpected error compiling %q: %v", tt.source, err)
+			continue
+		}
+		res := r.matchers[0].Match(tt.text, time.Now())
+		if res == nil {
+			t.Errorf("%q: no match", tt.text)
+			continue
+		}
+		if res.Literal != tt.literal || res.Ignored != tt.ignored {
+			t.Errorf("%q: got %d literal and %d ignored words expected %d and %d",
+				tt.text, res.Literal, res.Ignored, tt.literal, tt.ignored)
+		}
+	}
+}
+
+func TestPermutations(t *testing.T) {
+	perms := permutations(4)
+	if len(perms) != 24 {
+		t.Fatalf("got %d permutations expected 24", len(perms))
+	}
+	seen := make(map[string]bool)
+	for _, p := range perms {
+		seen[fmt.Sprint(p)] = true
+	}
+	if len(seen) != 24 {
+		t.Errorf("got %d distinct permutations expected 24", len(seen))
+	}
+	if got := fmt.Sprint(perms[0]); got != "[0 1 2 3]" {
+		t.Errorf("got first permutation %s expected the identity", got)
+	}
+}
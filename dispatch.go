@@ -0,0 +1,191 @@
+package vikyscript
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// A Describer is a Matcher that describes the parameters of its command, so
+// that handlers with typed signatures can be checked against them.
+type Describer interface {
+	Matcher
+	// Signature returns the names and the types of the parameters of the
+	// command, in order of appearance. Types are empty for named lists and
+	// untyped parameters.
+	Signature() (names, types []string)
+}
+
+// HandlerFunc is a handler receiving the whole match of its command.
+type HandlerFunc func(res *Result) error
+
+var (
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	resultType    = reflect.TypeOf((*Result)(nil))
+	typeErrorType = reflect.TypeOf([]int(nil))
+	timeType      = reflect.TypeOf(time.Time{})
+)
+
+// handler is a function bound to a command.
+type handler struct {
+	fn    reflect.Value
+	typed bool // Whether fn is passed the parameters rather than the result.
+}
+
+// Handle binds fn to the command with the given name, which must be in the
+// registry. fn is either a HandlerFunc, or a function with the same signature,
+// or a function returning an error that is passed the parameters of the
+// command in order of appearance, optionally followed by the indexes of the
+// parameters whose type conversion failed, as in
+//
+//	func(what string, percentage int, typeErrors []int) error
+//
+// Parameters can be passed as strings, integer parameters as ints and date
+// parameters as time.Time values, which are zero if the parameter is missing
+// or its conversion failed. Typed signatures can only be checked, and are
+// only allowed, if the command is a Describer.
+// Binding a function to a command replaces the one previously bound to it.
+func (r *Registry) Handle(name string, fn interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(name)
+	if i < 0 {
+		return fmt.Errorf("command %q not registered", name)
+	}
+	if fn == nil {
+		return fmt.Errorf("nil handler for command %q", name)
+	}
+	h := handler{fn: reflect.ValueOf(fn)}
+	typ := h.fn.Type()
+	if typ.Kind() != reflect.Func || typ.IsVariadic() || typ.NumOut() != 1 || typ.Out(0) != errorType {
+		return fmt.Errorf("handler of command %q must be a function returning an error, not %s", name, typ)
+	}
+	if typ.NumIn() != 1 || typ.In(0) != resultType {
+		d, ok := r.matchers[i].(Describer)
+		if !ok {
+			return fmt.Errorf("handler of command %q must be a HandlerFunc: the parameters of the command are unknown", name)
+		}
+		_, types := d.Signature()
+		if err := checkSignature(typ, types); err != nil {
+			return fmt.Errorf("handler of command %q: %v", name, err)
+		}
+		h.typed = true
+	}
+	if r.handlers == nil {
+		r.handlers = make(map[string]handler)
+	}
+	r.handlers[name] = h
+	return nil
+}
+
+// rebind unbinds the function bound to the command replaced by m if it cannot
+// be passed the parameters of m. r.mu must be held.
+func (r *Registry) rebind(m Matcher) {
+	h, ok := r.handlers[m.Name()]
+	if !ok || !h.typed {
+		return
+	}
+	if d, ok := m.(Describer); ok {
+		if _, types := d.Signature(); checkSignature(h.fn.Type(), types) == nil {
+			return
+		}
+	}
+	delete(r.handlers, m.Name())
+}
+
+// checkSignature reports whether a function of type typ can be passed
+// parameters of the given types.
+func checkSignature(typ reflect.Type, types []string) error {
+	n := typ.NumIn()
+	if n > 0 && typ.In(n-1) == typeErrorType {
+		n--
+	}
+	if n != len(types) {
+		return fmt.Errorf("got %d parameters, the command has %d", n, len(types))
+	}
+	for i, t := range types {
+		in := typ.In(i)
+		switch {
+		case in.Kind() == reflect.String:
+		case t == "integer" && isInt(in):
+		case t == "date" && in == timeType:
+		default:
+			return fmt.Errorf("parameter %d: cannot pass a value of type %q as %s", i, t, in)
+		}
+	}
+	return nil
+}
+
+// isInt reports whether typ is a signed integer type.
+func isInt(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+// Dispatch matches text as Match does, and calls the function bound to the
+// matched command with the result. It returns the error of the function, or
+// the error of Match if no command could be chosen.
+func (r *Registry) Dispatch(text string) error {
+	res, err := r.Match(text)
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	h, ok := r.handlers[res.Command]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler for command %q", res.Command)
+	}
+	if !h.typed {
+		return call(h.fn, reflect.ValueOf(res))
+	}
+	typ := h.fn.Type()
+	if n := typ.NumIn(); n != len(res.Params) && !(n == len(res.Params)+1 && typ.In(n-1) == typeErrorType) {
+		// The command was replaced after it matched.
+		return fmt.Errorf("handler of command %q: got %d parameters, the command has %d", res.Command, n, len(res.Params))
+	}
+	failed := make(map[int]bool)
+	for _, i := range res.TypeErrors {
+		failed[i] = true
+	}
+	args := make([]reflect.Value, typ.NumIn())
+	for i, p := range res.Params {
+		in := typ.In(i)
+		v := reflect.New(in).Elem()
+		switch {
+		case in.Kind() == reflect.String:
+			v.SetString(p.Value)
+		case failed[i] || p.Value == "":
+			// Leave the zero value.
+		case isInt(in):
+			n, err := strconv.ParseInt(p.Value, 10, in.Bits())
+			if err != nil {
+				return fmt.Errorf("handler of command %q: parameter %q: %v", res.Command, p.Name, err)
+			}
+			v.SetInt(n)
+		case in == timeType:
+			t, err := time.Parse(dateLayout, p.Value)
+			if err != nil {
+				return fmt.Errorf("handler of command %q: parameter %q: %v", res.Command, p.Name, err)
+			}
+			v.Set(reflect.ValueOf(t))
+		default:
+			return fmt.Errorf("handler of command %q: cannot pass parameter %q as %s", res.Command, p.Name, in)
+		}
+		args[i] = v
+	}
+	if len(args) > len(res.Params) {
+		args[len(args)-1] = reflect.ValueOf(append([]int{}, res.TypeErrors...))
+	}
+	return call(h.fn, args...)
+}
+
+// call calls fn with args and returns its error.
+func call(fn reflect.Value, args ...reflect.Value) error {
+	err, _ := fn.Call(args)[0].Interface().(error)
+	return err
+}
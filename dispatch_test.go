@@ -0,0 +1,166 @@
+package vikyscript
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dispatchScript = volumeCommand + "\n" + shoppingCommand + "\nsetVolume: set volume to {level:integer} percent"
+
+func newDispatchRecognizer(t *testing.T) *Recognizer {
+	r := NewRecognizer(dispatchScript)
+	r.Clock = func() time.Time { return dateNow }
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestDispatch(t *testing.T) {
+	r := newDispatchRecognizer(t)
+	var got string
+	err := r.Handle("volumeHandler", func(what string, percentage int, typeErrors []int) error {
+		got = fmt.Sprintf("%s %d %v", what, percentage, typeErrors)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Handle("shoppingList", func(action, what string, when time.Time) error {
+		got = fmt.Sprintf("%s %s %s", action, what, when.Format("2006-01-02"))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Handle("setVolume", HandlerFunc(func(res *Result) error {
+		got = fmt.Sprint(res.Params, res.TypeErrors)
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for text, exp := range map[string]string{
+		"Increase the volume of twenty percent":    "increase 20 []",
+		"Lower the volume":                         "lower 0 []",
+		"Add milk to tomorrow's shopping list":     "add milk 2017-05-11",
+		"Delete eggs from someday's shopping list": "delete eggs 0001-01-01",
+		"Set volume to a lot percent":              "[{level a lot}] [0]",
+	} {
+		got = ""
+		if err := r.Dispatch(text); err != nil {
+			t.Errorf("%q: unexpected error: %v", text, err)
+			continue
+		}
+		if got != exp {
+			t.Errorf("%q: got %q expected %q", text, got, exp)
+		}
+	}
+}
+
+func TestDispatchError(t *testing.T) {
+	r := newDispatchRecognizer(t)
+	errHandler := errors.New("handler error")
+	if err := r.Handle("setVolume", func(level string) error { return errHandler }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Dispatch("set volume to ten percent"); err != errHandler {
+		t.Errorf("got error %v expected %v", err, errHandler)
+	}
+	if err := r.Dispatch("turn on the lights"); err != ErrNoMatch {
+		t.Errorf("got error %v expected %v", err, ErrNoMatch)
+	}
+	if err := r.Dispatch("increase the volume"); err == nil {
+		t.Errorf("expected error for command without handler")
+	}
+}
+
+// compileCommand returns the only command of source, compiled.
+func compileCommand(t *testing.T, source string) Matcher {
+	r := NewRecognizer(source)
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	return r.matchers[0]
+}
+
+func TestDispatchReplaced(t *testing.T) {
+	r := newDispatchRecognizer(t)
+	called := false
+	if err := r.Handle("setVolume", func(level int) error { called = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Handle("shoppingList", func(*Result) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	// A function that can be passed the parameters of the new command stays
+	// bound to it.
+	r.Replace(compileCommand(t, "setVolume: volume at {level:integer}"))
+	if err := r.Dispatch("volume at ten"); err != nil || !called {
+		t.Errorf("handler not called: %v", err)
+	}
+	r.Replace(compileCommand(t, "setVolume: set volume to {level:date} percent"))
+	if err := r.Dispatch("set volume to ten percent"); err == nil || !strings.Contains(err.Error(), "no handler") {
+		t.Errorf("got error %v expected the handler to be unbound", err)
+	}
+	r.SetPriority("shoppingList", 1)
+	if !r.Remove("shoppingList") {
+		t.Fatal("shoppingList not removed")
+	}
+	if err := r.Add(compileCommand(t, "shoppingList: buy {what}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Dispatch("buy milk"); err == nil || !strings.Contains(err.Error(), "no handler") {
+		t.Errorf("got error %v expected the handler to be removed", err)
+	}
+	if p := r.priorities["shoppingList"]; p != 0 {
+		t.Errorf("got priority %d expected it to be removed", p)
+	}
+}
+
+var handleErrorTests = []struct {
+	name    string
+	command string
+	fn      interface{}
+}{
+	{"unknown", "turnOn", func(*Result) error { return nil }},
+	{"nil", "setVolume", nil},
+	{"notfunc", "setVolume", "setVolume"},
+	{"noerror", "setVolume", func(level int) {}},
+	{"tworesults", "setVolume", func(level int) (int, error) { return 0, nil }},
+	{"variadic", "setVolume", func(levels ...string) error { return nil }},
+	{"fewparams", "volumeHandler", func(what string) error { return nil }},
+	{"manyparams", "setVolume", func(level, other string, typeErrors []int) error { return nil }},
+	{"untypedint", "shoppingList", func(action string, what int, when string) error { return nil }},
+	{"datetime", "setVolume", func(level time.Time) error { return nil }},
+	{"result", "setVolume", func(res Result) error { return nil }},
+}
+
+func TestHandleError(t *testing.T) {
+	r := newDispatchRecognizer(t)
+	for _, tt := range handleErrorTests {
+		if err := r.Handle(tt.command, tt.fn); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
+
+func TestHandleUndescribed(t *testing.T) {
+	r := new(Registry)
+	if err := r.Add(wordMatcher("lights")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Handle("lights", func(what string) error { return nil }); err == nil {
+		t.Errorf("expected error for typed handler of a command that is not a Describer")
+	}
+	called := false
+	if err := r.Handle("lights", func(*Result) error { called = true; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Dispatch("turn on the lights"); err != nil || !called {
+		t.Errorf("handler not called: %v", err)
+	}
+}
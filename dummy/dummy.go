@@ -3,131 +3,123 @@ package dummy
 import (
 	"fmt"
 	"regexp"
-	"runtime"
 	"strings"
-	"sync"
+	"time"
+
+	vikyscript "github.com/empijei/VikyScript"
 )
 
-var state []Matcher
-var state_m sync.RWMutex
+// typeSep separates the name of a group from the type of the parameter, as in
+// (?P<amount__integer>.*)
+const typeSep = "__"
 
 type Command struct {
 	Name   string
 	Params []string
+	Types  []string // The types of the Params, empty if not specified.
 	raw    string
 }
 
+// Matcher matches sentences against a command written as a regular
+// expression. It implements vikyscript.Describer.
 type Matcher struct {
 	*regexp.Regexp
 	Command
 }
 
-//func (m *Matcher) Match(text string) (commandName string, paramValues []string [>Maybe use dictionary here?<], err error) {
-//}
-
-func Parse(code string) (commandName string, paramNames []string, err error) {
+// Compile compiles code, in the form "name:regexp", to a Matcher. The named
+// groups of the regular expression are the parameters of the command.
+func Compile(code string) (*Matcher, error) {
 	var m Matcher
 	m.raw = code
 	var retext string
 	if index := strings.Index(code, ":"); index > 0 {
-		commandName = code[:index]
+		m.Command.Name = code[:index]
 		retext = code[index+1:]
 	} else {
-		err = fmt.Errorf("Invalid command, no name specified")
-		return
+		return nil, fmt.Errorf("Invalid command, no name specified")
 	}
-	m.Name = commandName
+	var err error
 	m.Regexp, err = regexp.Compile(retext)
 	if err != nil {
-		return
+		return nil, err
 	}
 	for _, p := range m.SubexpNames() {
-		if p != "" {
-			m.Params = append(m.Params, p)
+		if p == "" {
+			continue
 		}
+		typ := ""
+		if i := strings.Index(p, typeSep); i > 0 {
+			p, typ = p[:i], p[i+len(typeSep):]
+			if !vikyscript.IsType(typ) {
+				return nil, fmt.Errorf("Invalid command, unknown type %q", typ)
+			}
+		}
+		m.Params = append(m.Params, p)
+		m.Types = append(m.Types, typ)
 	}
-	paramNames = m.Params
-	state_m.Lock()
-	defer state_m.Unlock()
-	state = append(state, m)
-	return
+	return &m, nil
 }
 
-type ClashError struct {
-	matches []string
+// Parse compiles code and adds it to the registry r.
+func Parse(r *vikyscript.Registry, code string) (commandName string, paramNames []string, err error) {
+	m, err := Compile(code)
+	if err != nil {
+		return
+	}
+	if err = r.Add(m); err != nil {
+		return
+	}
+	return m.Command.Name, m.Params, nil
 }
 
-func (ce *ClashError) Error() string {
-	return fmt.Sprintf("Clash of commands: %s", strings.Join(ce.matches, ", "))
+// Name returns the name of the command.
+func (m *Matcher) Name() string {
+	return m.Command.Name
 }
 
-type MatchResult struct {
-	m       Matcher
-	results map[string]string
+// Signature returns the names and the types of the parameters of the command.
+func (m *Matcher) Signature() (names, types []string) {
+	return m.Params, m.Types
 }
 
-func Match(text string) (commandName string, paramValues map[string]string, err error) {
+// Match matches text against the command. Values of typed parameters are
+// converted, and the indexes of the ones whose conversion failed are reported
+// in the TypeErrors of the result, in order of appearance of the parameters.
+// Parameters in groups that did not participate in the match are empty.
+func (m *Matcher) Match(text string, now time.Time) *vikyscript.Result {
 	//Matching is case insensitive for the sake of what is right
 	text = strings.ToLower(text)
-	pool := runtime.NumCPU()
-	tomatch := make(chan Matcher)
-	matchedChan := make(chan MatchResult)
-	var wg sync.WaitGroup
-	wg.Add(pool)
-	state_m.RLock()
-	defer state_m.RUnlock()
-	//spawn workers
-	for i := 0; i < pool; i++ {
-		go func() {
-			//Signal we finished processing data
-			defer wg.Done()
-			for tm := range tomatch {
-				result := tm.FindStringSubmatch(text)
-				if result == nil {
-					continue
-				}
-				paramsMap := make(map[string]string)
-				for i, name := range tm.SubexpNames() {
-					if i > 0 && i <= len(result) {
-						paramsMap[name] = result[i]
-					}
-				}
-				matchedChan <- MatchResult{m: tm, results: paramsMap}
-			}
-		}()
+	loc := m.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return nil
 	}
-	//Send the matchers to the workers
-	go func() {
-		for _, m := range state {
-			tomatch <- m
+	// Words in parameters are not literal.
+	res := &vikyscript.Result{Command: m.Command.Name, Literal: len(strings.Fields(text[loc[0]:loc[1]]))}
+	k := 0
+	for i, name := range m.SubexpNames() {
+		if name == "" {
+			continue
 		}
-		close(tomatch)
-		//Let the matchers match
-		wg.Wait()
-		//Signal we are done
-		close(matchedChan)
-	}()
-	var matchedList []MatchResult
-	for m := range matchedChan {
-		matchedList = append(matchedList, m)
-	}
-	switch l := len(matchedList); {
-	case l > 1:
-		var matches []string
-		for _, m := range matchedList {
-			matches = append(matches, m.m.Name)
+		var value string
+		if loc[2*i] >= 0 {
+			value = text[loc[2*i]:loc[2*i+1]]
 		}
-		err = &ClashError{
-			matches: matches,
+		res.Literal -= len(strings.Fields(value))
+		if m.Types[k] != "" && loc[2*i] >= 0 {
+			v, err := vikyscript.Convert(m.Types[k], value, now)
+			if err != nil {
+				res.TypeErrors = append(res.TypeErrors, k)
+			} else {
+				value = v
+			}
 		}
-		//Maybe fallthrough here? We might want to return the value of one of the
-		//matches.
-	case l == 1:
-		commandName = matchedList[0].m.Name
-		//paramValues = matched[0].
-		paramValues = matchedList[0].results
-	default:
-		err = fmt.Errorf("No match")
+		res.Params = append(res.Params, vikyscript.Param{Name: m.Params[k], Value: value})
+		k++
+	}
+	// Words that are not part of the match are ignored.
+	if words := len(strings.Fields(text)); words > 0 {
+		res.Score = float64(res.Literal) / float64(words)
 	}
-	return
+	return res
 }
@@ -1,8 +1,11 @@
 package dummy
 
 import (
+	"fmt"
 	"strings"
 	"testing"
+
+	vikyscript "github.com/empijei/VikyScript"
 )
 
 var ParseTests = []struct {
@@ -15,27 +18,35 @@ var ParseTests = []struct {
 		"command",
 		[]string{"first", "second"},
 	},
+	{
+		"command:(?P<first__integer>)(foo)(?P<second>)",
+		"command",
+		[]string{"first", "second"},
+	},
 }
 
 func TestParse(t *testing.T) {
 	for _, tt := range ParseTests {
-		name, params, err := Parse(tt.in)
+		var r vikyscript.Registry
+		name, params, err := Parse(&r, tt.in)
 		if err != nil ||
 			name != tt.outname ||
 			strings.Join(params, "|") != strings.Join(tt.outparams, "|") {
 			t.Errorf("Error in parse")
 		}
-		//Cleanup
-		state = make([]Matcher, 0)
+		if got := r.List(); len(got) != 1 || got[0] != tt.outname {
+			t.Errorf("Unexpected commands: %v", got)
+		}
 	}
 }
 
 var MatchTestsSuccess = []struct {
-	source     string
-	tomatch    string
-	expCommand string
-	expParams  map[string]string
-	expError   error
+	source        string
+	tomatch       string
+	expCommand    string
+	expParams     map[string]string
+	expTypeErrors []int
+	expError      error
 }{
 	{
 		"command:(?P<first>[a-z]*) (?P<second>[a-z]*)",
@@ -43,27 +54,94 @@ var MatchTestsSuccess = []struct {
 		"command",
 		map[string]string{"first": "prova", "second": "uno"},
 		nil,
+		nil,
+	},
+	{
+		"volume:set volume to (?P<level__integer>[a-z ]*) percent",
+		"set volume to twenty five percent",
+		"volume",
+		map[string]string{"level": "25"},
+		nil,
+		nil,
+	},
+	{
+		"remind:remind me to (?P<what>[a-z ]*) (?P<amount__integer>[a-z]*) times (?P<when__date>[a-z]*)",
+		"remind me to drink water lots times someday",
+		"remind",
+		map[string]string{"what": "drink water", "amount": "lots", "when": "someday"},
+		[]int{1, 2},
+		nil,
+	},
+	{
+		"go:^go(?: (?P<steps__integer>[a-z0-9]+))?$",
+		"go",
+		"go",
+		map[string]string{"steps": ""},
+		nil,
+		nil,
 	},
 }
 
-//TODO test with many commands
 func TestMatchSuccess(t *testing.T) {
 	for _, tt := range MatchTestsSuccess {
-		_, _, err := Parse(tt.source)
+		var r vikyscript.Registry
+		_, _, err := Parse(&r, tt.source)
 		if err != nil {
 			t.Errorf("Error in parse")
 		}
-		name, values, err := Match(tt.tomatch)
+		res, err := r.Match(tt.tomatch)
 		if err != tt.expError {
-			t.Errorf("Unexpected error: " + err.Error())
+			t.Errorf("Unexpected error: %v", err)
+			continue
 		}
-		if tt.expCommand != name {
-			t.Errorf("Unexpected name: " + name)
+		if tt.expCommand != res.Command {
+			t.Errorf("Unexpected name: %s", res.Command)
+		}
+		values := make(map[string]string)
+		for _, p := range res.Params {
+			values[p.Name] = p.Value
 		}
 		if !areMapsEqual(tt.expParams, values) {
 			t.Errorf("Unexpected params: %#v", values)
 		}
-		state = make([]Matcher, 0)
+		if fmt.Sprint(res.TypeErrors) != fmt.Sprint(tt.expTypeErrors) {
+			t.Errorf("Unexpected type errors: %v", res.TypeErrors)
+		}
+	}
+}
+
+func TestIsolatedRegistries(t *testing.T) {
+	var first, second vikyscript.Registry
+	if _, _, err := Parse(&first, "greet:hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Parse(&second, "greet:hello (?P<who>[a-z]+)"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := first.Match("hello")
+	if err != nil || len(res.Params) != 0 {
+		t.Errorf("Unexpected match: %v %v", res, err)
+	}
+	res, err = second.Match("hello world")
+	if err != nil || len(res.Params) != 1 {
+		t.Errorf("Unexpected match: %v %v", res, err)
+	}
+}
+
+func TestClash(t *testing.T) {
+	var r vikyscript.Registry
+	for _, code := range []string{"turnOn:turn on (?P<device>.*)", "lights:turn on the lights"} {
+		if _, _, err := Parse(&r, code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := r.Match("turn on the lights"); err == nil {
+		t.Errorf("Expected clash")
+	}
+	r.Policy = vikyscript.ClashMostSpecific
+	res, err := r.Match("turn on the lights")
+	if err != nil || res.Command != "lights" {
+		t.Errorf("Unexpected match: %v %v", res, err)
 	}
 }
 
@@ -78,3 +156,23 @@ func areMapsEqual(a, b map[string]string) bool {
 	}
 	return true
 }
+
+func TestDispatch(t *testing.T) {
+	var r vikyscript.Registry
+	if _, _, err := Parse(&r, "volume:set volume to (?P<level__integer>[a-z ]*) percent"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Handle("volume", func(level string) error { return nil }); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := r.Handle("volume", func(level, other string) error { return nil }); err == nil {
+		t.Errorf("expected error for a handler with the wrong number of parameters")
+	}
+	var got int
+	if err := r.Handle("volume", func(level int) error { got = level; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Dispatch("set volume to forty two percent"); err != nil || got != 42 {
+		t.Errorf("got level %d and error %v", got, err)
+	}
+}
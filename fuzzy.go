@@ -0,0 +1,150 @@
+package vikyscript
+
+import "strings"
+
+// fix returns the normalized text with the words that are not words of the
+// command replaced by the closest word of the command, if it is within the
+// tolerance of the command and no other word is as close. Words are only
+// replaced if at most a third of their letters is misspelled, so that short
+// words, which are easily confused, are left untouched.
+// If the command matches words phonetically, the words that are not close to
+// any word are replaced by the word of a list that sounds the same, if there
+// is only one.
+func (c *command) fix(text string) string {
+	words := strings.Fields(text)
+	for i, w := range words {
+		if c.words[w] {
+			continue
+		}
+		if fixed, ok := c.closest(w); ok {
+			words[i] = fixed
+			continue
+		}
+		if !c.phonetic {
+			continue
+		}
+		if fixed, ok := c.homophone(w); ok {
+			words[i] = fixed
+		}
+	}
+	if len(words) == 0 {
+		return text
+	}
+	return " " + strings.Join(words, " ")
+}
+
+// closest returns the word of the command closest to w, if any is within the
+// tolerance and is the only one at that distance.
+func (c *command) closest(w string) (string, bool) {
+	best, bestDist, unique := "", c.tolerance+1, false
+	for word := range c.words {
+		d := distance(w, word)
+		if d > c.tolerance || 3*d > len([]rune(word)) {
+			continue
+		}
+		switch {
+		case d < bestDist:
+			best, bestDist, unique = word, d, true
+		case d == bestDist:
+			unique = false
+		}
+	}
+	return best, unique
+}
+
+// distance returns the Levenshtein distance between a and b: the number of
+// letters to insert, delete or substitute to turn one into the other.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cur[j] = prev[j-1]
+			if ra[i-1] != rb[j-1] {
+				cur[j]++
+			}
+			if d := prev[j] + 1; d < cur[j] {
+				cur[j] = d
+			}
+			if d := cur[j-1] + 1; d < cur[j] {
+				cur[j] = d
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// homophone returns the word of the lists of the command that sounds like w,
+// if there is only one.
+func (c *command) homophone(w string) (string, bool) {
+	code := soundex(w)
+	if code == "" {
+		return "", false
+	}
+	found := ""
+	for word := range c.listWords {
+		if soundex(word) != code {
+			continue
+		}
+		if found != "" {
+			return "", false
+		}
+		found = word
+	}
+	return found, found != ""
+}
+
+// soundexCodes holds the Soundex digit of every consonant; vowels and the
+// letters h, w and y have none.
+var soundexCodes = map[rune]byte{
+	'b': '1', 'f': '1', 'p': '1', 'v': '1',
+	'c': '2', 'g': '2', 'j': '2', 'k': '2', 'q': '2', 's': '2', 'x': '2', 'z': '2',
+	'd': '3', 't': '3',
+	'l': '4',
+	'm': '5', 'n': '5',
+	'r': '6',
+}
+
+// soundex returns the American Soundex code of the lowercase word w, in
+// lowercase: its first letter followed by three digits encoding the sound of
+// the consonants that follow. Letters other than a to z are skipped, and the
+// code is empty if w has none.
+func soundex(w string) string {
+	var code []byte
+	var last byte
+	for _, r := range w {
+		if r < 'a' || r > 'z' {
+			continue
+		}
+		digit := soundexCodes[r]
+		if code == nil {
+			code, last = []byte{byte(r)}, digit
+			continue
+		}
+		switch {
+		case digit != 0 && digit != last:
+			code = append(code, digit)
+			if len(code) == 4 {
+				return string(code)
+			}
+		case r == 'h' || r == 'w':
+			// Consonants with the same code separated by h or w are coded
+			// once.
+			continue
+		}
+		last = digit
+	}
+	if code == nil {
+		return ""
+	}
+	for len(code) < 4 {
+		code = append(code, '0')
+	}
+	return string(code)
+}
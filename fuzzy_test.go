@@ -0,0 +1,138 @@
+package vikyscript
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+var distanceTests = []struct {
+	a, b string
+	dist int
+}{
+	{"", "", 0},
+	{"volume", "volume", 0},
+	{"volum", "volume", 1},
+	{"decrese", "decrease", 1},
+	{"lover", "lower", 1},
+	{"kitten", "sitting", 3},
+	{"", "abc", 3},
+	{"perché", "perche", 1},
+}
+
+func TestDistance(t *testing.T) {
+	for _, tt := range distanceTests {
+		if got := distance(tt.a, tt.b); got != tt.dist {
+			t.Errorf("distance(%q, %q): got %d expected %d", tt.a, tt.b, got, tt.dist)
+		}
+		if got := distance(tt.b, tt.a); got != tt.dist {
+			t.Errorf("distance(%q, %q): got %d expected %d", tt.b, tt.a, got, tt.dist)
+		}
+	}
+}
+
+var fuzzyTests = []struct {
+	source, text string
+	tolerance    int
+	params       []Param // nil if the text must not match.
+	score        float64
+}{
+	{volumeCommand, "Decrese the volum", 1,
+		[]Param{{"what", "decrease"}, {"percentage", ""}}, 1.0 / 3},
+	{volumeCommand, "Decrese the volum", 0, nil, 0},
+	{"setVolume: set volume to {level:integer} percent", "Set volum to twenty pecent", 1,
+		[]Param{{"level", "20"}}, 3.0 / 5},
+	{volumeCommand, "Increase the vlm", 2, nil, 0},
+	{volumeCommand, "Increase the vlume", 2,
+		[]Param{{"what", "increase"}, {"percentage", ""}}, 1.5 / 3},
+	{shoppingCommand, "Ad lover to tomorrow's shopping lisst", 1,
+		[]Param{{"action", "add"}, {"what", "lover"}, {"when", "2017-05-11T00:00:00Z"}}, 3.0 / 6},
+	{"command: [what:lower,lover] it", "loer it", 1, nil, 0},
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	for _, tt := range fuzzyTests {
+		r := NewRecognizer(tt.source)
+		r.Clock = func() time.Time { return dateNow }
+		r.Tolerance = tt.tolerance
+		if err := r.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		res, err := r.Match(tt.text)
+		if tt.params == nil {
+			if err != ErrNoMatch {
+				t.Errorf("%q with tolerance %d: got %v expected %v", tt.text, tt.tolerance, err, ErrNoMatch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q with tolerance %d: unexpected error: %v", tt.text, tt.tolerance, err)
+			continue
+		}
+		if got, exp := fmt.Sprint(res.Params), fmt.Sprint(tt.params); got != exp {
+			t.Errorf("%q: got params %s expected %s", tt.text, got, exp)
+		}
+		if res.Score != tt.score {
+			t.Errorf("%q: got score %v expected %v", tt.text, res.Score, tt.score)
+		}
+	}
+}
+
+var soundexTests = []struct {
+	word, code string
+}{
+	{"robert", "r163"},
+	{"rupert", "r163"},
+	{"ashcraft", "a261"},
+	{"tymczak", "t522"},
+	{"pfister", "p236"},
+	{"lower", "l600"},
+	{"lore", "l600"},
+	{"to", "t000"},
+	{"two", "t000"},
+	{"tomorrow's", "t562"},
+	{"42", ""},
+}
+
+func TestSoundex(t *testing.T) {
+	for _, tt := range soundexTests {
+		if got := soundex(tt.word); got != tt.code {
+			t.Errorf("soundex(%q): got %q expected %q", tt.word, got, tt.code)
+		}
+	}
+}
+
+var phoneticTests = []struct {
+	source, text string
+	params       []Param // nil if the text must not match.
+}{
+	{volumeCommand, "Lore the volume", []Param{{"what", "lower"}, {"percentage", ""}}},
+	{"setTimer: set a timer for [amount:one,two,three] minutes", "Set a timer for too minutes",
+		[]Param{{"amount", "two"}}},
+	{"setTimer: set a timer for [amount:one,two,three] minutes", "Set a tymer for too minutes", nil},
+	{"setTimer: set a timer for [amount:ten,tin] minutes", "Set a timer for tan minutes", nil},
+}
+
+func TestPhoneticMatch(t *testing.T) {
+	for _, tt := range phoneticTests {
+		r := NewRecognizer(tt.source)
+		r.Phonetic = true
+		if err := r.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		res, err := r.Match(tt.text)
+		if tt.params == nil {
+			if err != ErrNoMatch {
+				t.Errorf("%q: got %v expected %v", tt.text, err, ErrNoMatch)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.text, err)
+			continue
+		}
+		if got, exp := fmt.Sprint(res.Params), fmt.Sprint(tt.params); got != exp {
+			t.Errorf("%q: got params %s expected %s", tt.text, got, exp)
+		}
+	}
+}
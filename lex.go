@@ -49,13 +49,18 @@ const (
 	itemIgnore
 	itemLeftParen
 	itemRightParen
+	itemNewline // end of a command
+	itemEquals  // '=' separating a synonym from its value
+	itemPipe    // '|' separating synonyms with the same value
 	// Keywords appear after all the rest.
 	itemKeyword     // used only to delimit the keywords
 	itemCommandName // name of the command
 	itemWord        // words
 	itemListName    // name of a named list
+	itemDefinition  // name of a list definition
 	itemParamName   // name of a parameter
 	itemParamType   // type of a typed parameter
+	itemParamValue  // default value of a parameter
 )
 
 const eof = -1
@@ -128,8 +133,6 @@ func (l *lexer) backup() {
 // emit passes an item back to the client.
 func (l *lexer) emit(t itemType) {
 	l.items <- item{t, l.start, l.input[l.start:l.pos], l.line}
-	// Some items contain text internally. If so, count their newlines.
-	l.line += strings.Count(l.input[l.start:l.pos], "\n")
 	l.start = l.pos
 }
 
@@ -190,7 +193,7 @@ func lex(name, input string) *lexer {
 
 // run runs the state machine for the lexer.
 func (l *lexer) run() {
-	for l.state = lexCommandName; l.state != nil; {
+	for l.state = lexScript; l.state != nil; {
 		l.state = l.state(l)
 	}
 	close(l.items)
@@ -206,20 +209,53 @@ func (l *lexer) unexpectedChar(r rune) stateFn {
 // state functions
 
 const (
-	openParen   = '('
-	closedParen = ')'
-	openList    = '['
-	closedList  = ']'
-	openParam   = '{'
-	closedParam = '}'
-	nameDelim   = ':'
-	listDelim   = ','
-	shuffle     = '#'
-	optional    = '?'
-	ignore      = '*'
+	openParen    = '('
+	closedParen  = ')'
+	openList     = '['
+	closedList   = ']'
+	openParam    = '{'
+	closedParam  = '}'
+	nameDelim    = ':'
+	listDelim    = ','
+	aliasDelim   = '='
+	synonymDelim = '|'
+	listRef      = '@'
+	shuffle      = '#'
+	optional     = '?'
+	ignore       = '*'
+	comment      = "//" // a line starting with a shuffle operator is a comment as well
 )
 
-// lexCommandName scans until an opening action delimiter, "{{".
+// lexScript scans the beginning of a line of a script, skipping blank lines
+// and lines of comments.
+func lexScript(l *lexer) stateFn {
+	for {
+		switch r := l.peek(); {
+		case r == eof:
+			l.emit(itemEOF)
+			return nil
+		case isSpace(r) || isEndOfLine(r):
+			l.next()
+			l.ignore()
+		case r == shuffle || strings.HasPrefix(l.input[l.pos:], comment):
+			return lexComment
+		case r == listRef:
+			return lexDefinition
+		default:
+			return lexCommandName
+		}
+	}
+}
+
+// lexComment skips a comment up to the end of the line.
+func lexComment(l *lexer) stateFn {
+	for r := l.next(); !isEndOfLine(r) && r != eof; r = l.next() {
+	}
+	l.ignore()
+	return lexScript
+}
+
+// lexCommandName scans the name of a command up to the colon.
 func lexCommandName(l *lexer) stateFn {
 	l.width = 0
 	for {
@@ -238,11 +274,46 @@ func lexCommandName(l *lexer) stateFn {
 	}
 }
 
+// lexDefinition scans the name of a list definition up to the equal sign, and
+// the left bracket of the list.
+func lexDefinition(l *lexer) stateFn {
+	l.next()
+	l.ignore()
+	for {
+		switch r := l.next(); {
+		case r == aliasDelim:
+			l.backup()
+			l.emit(itemDefinition)
+			l.next()
+			l.emit(itemEquals)
+			for isSpace(l.peek()) {
+				l.next()
+				l.ignore()
+			}
+			if r := l.next(); r != openList {
+				return l.unexpectedChar(r)
+			}
+			l.emit(itemLeftList)
+			return lexList
+		case isAlphaNumeric(r) || isSpace(r):
+			//keep going, the parser will handle whitespace
+		default:
+			return l.unexpectedChar(r)
+		}
+	}
+}
+
 func lexCommand(l *lexer) stateFn {
 	for {
 		switch r := l.next(); {
 		case isSpace(r):
 			return lexSpace
+		case isEndOfLine(r):
+			if l.parenDepth != 0 {
+				return l.errorf("Unexpected end of line: unmatched left paren")
+			}
+			l.emit(itemNewline)
+			return lexScript
 		case isAlphaNumeric(r):
 			return lexWord
 		case r == openList:
@@ -297,7 +368,7 @@ func lexList(l *lexer) stateFn {
 	}
 	for {
 		switch r := l.peek(); {
-		case isAlphaNumeric(r) || isSpace(r):
+		case isAlphaNumeric(r) || isSpace(r) || r == listRef:
 			//either parsing the list name or the first element of the list
 			//parser will be responsible of trimming/replacing whitespace
 			l.next()
@@ -312,6 +383,18 @@ func lexList(l *lexer) stateFn {
 			l.next()
 			l.emit(itemColon)
 			return lexUnnamedList
+		case r == aliasDelim:
+			//this is an unnamed list whose first word has a value
+			l.emit(itemWord)
+			l.next()
+			l.emit(itemEquals)
+			return lexUnnamedList
+		case r == synonymDelim:
+			//this is an unnamed list whose first word has synonyms
+			l.emit(itemWord)
+			l.next()
+			l.emit(itemPipe)
+			return lexUnnamedList
 		case r == closedList:
 			l.emit(itemWord)
 			l.next()
@@ -326,13 +409,23 @@ func lexList(l *lexer) stateFn {
 func lexUnnamedList(l *lexer) stateFn {
 	for {
 		switch r := l.next(); {
-		case isAlphaNumeric(r) || isSpace(r):
-			//keep going
+		case isAlphaNumeric(r) || isSpace(r) || r == listRef:
+			//keep going, references to lists are handled by the parser
 		case r == listDelim:
 			l.backup()
 			l.emit(itemWord)
 			l.next()
 			l.ignore()
+		case r == aliasDelim:
+			l.backup()
+			l.emit(itemWord)
+			l.next()
+			l.emit(itemEquals)
+		case r == synonymDelim:
+			l.backup()
+			l.emit(itemWord)
+			l.next()
+			l.emit(itemPipe)
 		case r == closedList:
 			l.backup()
 			l.emit(itemWord)
@@ -361,6 +454,11 @@ func lexParam(l *lexer) stateFn {
 			l.next()
 			l.emit(itemColon)
 			return lexTypedParam
+		case r == aliasDelim:
+			l.emit(itemParamName)
+			l.next()
+			l.emit(itemEquals)
+			return lexParamValue
 		case r == closedParam:
 			l.emit(itemParamName)
 			l.next()
@@ -378,6 +476,12 @@ func lexTypedParam(l *lexer) stateFn {
 		case isAlphaNumeric(r) || isSpace(r):
 			//parser will handle whitespace
 			//this could be removed...
+		case r == aliasDelim:
+			l.backup()
+			l.emit(itemParamType)
+			l.next()
+			l.emit(itemEquals)
+			return lexParamValue
 		case r == closedParam:
 			l.backup()
 			l.emit(itemParamType)
@@ -390,6 +494,23 @@ func lexTypedParam(l *lexer) stateFn {
 	}
 }
 
+// lexParamValue scans the default value of a parameter, which can hold any
+// character but the right brace.
+func lexParamValue(l *lexer) stateFn {
+	for {
+		switch r := l.next(); {
+		case r == closedParam:
+			l.backup()
+			l.emit(itemParamValue)
+			l.next()
+			l.emit(itemRightParam)
+			return lexCommand
+		case r == eof || isEndOfLine(r):
+			return l.unexpectedChar(r)
+		}
+	}
+}
+
 // lexSpace scans a run of space characters.
 // One space has already been seen.
 func lexSpace(l *lexer) stateFn {
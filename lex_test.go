@@ -20,12 +20,17 @@ var itemNames = []string{
 	"Ignore",
 	"LeftParen",
 	"RightParen",
+	"Newline",
+	"Equals",
+	"Pipe",
 	"Keyword",
 	"CommandName",
 	"Word",
 	"ListName",
+	"Definition",
 	"ParamName",
 	"ParamType",
+	"ParamValue",
 }
 
 var lexTests = []struct {
@@ -39,10 +44,22 @@ var lexTests = []struct {
 	{"typedparam", "command:{foo:integer}"},
 	{"listspace", "command:[foo foo,bar , lol]"},
 	{"namedlistspace", "command:[which one : foo,bar]"},
+	{"alias", "command:[lower=decrease,increase]"},
+	{"namedalias", "command:[what:increase, lower = decrease, decrease]"},
+	{"synonyms", "command:[add|sum|put together=add, remove | delete=remove]"},
+	{"namedsynonyms", "command:[op:add|sum|put together=add, remove|delete=remove]"},
 	{"paramspace", "command:{ foo } "},
 	{"typedparamspace", "command: { foo : integer }"},
+	{"paramvalue", "command:{foo=bar baz}"},
+	{"typedparamvalue", "command:{ foo : integer = 10 }"},
+	{"datevalue", "command:{when:date=2017-05-10}"},
 	{"unary", "command: * ?(foo) bar #(foo bar) * ?foo"},
 	{"nested", "command: * ?(foo #(bar bar)) "},
+	{"script", "first: foo\nsecond: bar\r\n\n  third: baz\n"},
+	{"comments", "// the first command\nfirst: foo\n# the second command\n  // indented\nsecond: #(bar baz)"},
+	{"empty", "\n\n"},
+	{"definition", "@colors = [red, green, blue]\npaint: paint it [color:@colors, black]"},
+	{"definitionspace", "@ dark colors=[black,dark blue=blue]\n"},
 }
 
 func TestCorrect(t *testing.T) {
@@ -71,6 +88,14 @@ var lexErrorTests = []struct {
 	{"unendedparam", "command:{"},
 	{"unendedlist", "command:[foo,"},
 	{"unendedparam", "command:{bar:"},
+	{"unmatchedline", "command:(foo\nbar)"},
+	{"newlinelist", "command:[foo,\nbar]"},
+	{"newlinename", "command\n:foo"},
+	{"unendedvalue", "command:{foo=bar"},
+	{"newlinevalue", "command:{foo=bar\n}"},
+	{"definitionnoequals", "@colors [red]"},
+	{"definitionnolist", "@colors = red"},
+	{"trailingcomment", "command:foo // bar"},
 }
 
 func TestError(t *testing.T) {
@@ -0,0 +1,245 @@
+// Command libvikyscript is a C shared library exposing recognizers to other
+// languages, such as Python through the vikyscript module in this directory.
+// Build it with
+//
+//	go build -buildmode=c-shared -o libvikyscript.so ./libvikyscript
+//
+// The functions are declared in vikyscript.h, the stable C interface of the
+// library. Recognizers are referred to by handles. Everything returned by the
+// library is owned by the caller, which must release it with the free routine
+// of its type.
+package main
+
+/*
+#include <stdlib.h>
+#include "vikyscript.h"
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"unsafe"
+
+	vikyscript "github.com/empijei/VikyScript"
+)
+
+// maxArray is the length of the arrays C memory is accessed through.
+const maxArray = 1 << 28
+
+var (
+	mu          sync.Mutex
+	recognizers = make(map[C.int]*vikyscript.Recognizer)
+	lastHandle  C.int
+)
+
+// param is a parameter of a match, encoded as JSON.
+type param struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// result is the outcome of a match, encoded as JSON. Error is set, and the
+// fields of the match are empty, if the match failed.
+type result struct {
+	Command    string  `json:"command,omitempty"`
+	Params     []param `json:"params,omitempty"`
+	TypeErrors []int   `json:"type_errors,omitempty"`
+	Score      float64 `json:"score,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	NoMatch    bool    `json:"no_match,omitempty"` // Whether no command matched.
+}
+
+// vs_load compiles script and returns the handle of the recognizer, which
+// must be released with vs_unload. It returns 0 and sets *err, if err is not
+// NULL, if the script is invalid.
+//
+//export vs_load
+func vs_load(script *C.char, err **C.char) C.int {
+	r := vikyscript.NewRecognizer(C.GoString(script))
+	if e := r.Compile(); e != nil {
+		if err != nil {
+			*err = C.CString(e.Error())
+		}
+		return 0
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	lastHandle++
+	recognizers[lastHandle] = r
+	return lastHandle
+}
+
+// vs_unload releases the recognizer with the given handle.
+//
+//export vs_unload
+func vs_unload(handle C.int) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(recognizers, handle)
+}
+
+// vs_match matches text against the commands of the recognizer with the
+// given handle, and returns the result as a JSON object: either
+//
+//	{"command": "...", "params": [{"name": "...", "value": "..."}], "type_errors": [0], "score": 0.5}
+//
+// or {"error": "...", "no_match": true} if no command matched, and
+// {"error": "..."} if no command could be chosen among the ones that matched.
+//
+//export vs_match
+func vs_match(handle C.int, text *C.char) *C.char {
+	r := lookup(handle)
+	var res result
+	if r == nil {
+		res.Error = "invalid handle"
+	} else if m, err := r.Match(C.GoString(text)); err != nil {
+		res.Error, res.NoMatch = err.Error(), err == vikyscript.ErrNoMatch
+	} else {
+		res.Command, res.TypeErrors, res.Score = m.Command, m.TypeErrors, m.Score
+		for _, p := range m.Params {
+			res.Params = append(res.Params, param{Name: p.Name, Value: p.Value})
+		}
+	}
+	b, _ := json.Marshal(res)
+	return C.CString(string(b))
+}
+
+// lookup returns the recognizer with the given handle, or nil.
+func lookup(handle C.int) *vikyscript.Recognizer {
+	mu.Lock()
+	defer mu.Unlock()
+	return recognizers[handle]
+}
+
+// vs_match_result matches text against the commands of the recognizer with
+// the given handle, and sets *res to the result, which must be released with
+// vs_free_result. It returns VS_OK on success, and otherwise VS_NO_MATCH or
+// VS_ERROR and sets *err, if err is not NULL.
+//
+//export vs_match_result
+func vs_match_result(handle C.int, text *C.char, res **C.vs_result, err **C.char) C.int {
+	fail := func(code C.int, msg string) C.int {
+		if err != nil {
+			*err = C.CString(msg)
+		}
+		return code
+	}
+	r := lookup(handle)
+	if r == nil {
+		return fail(C.VS_ERROR, "invalid handle")
+	}
+	m, e := r.Match(C.GoString(text))
+	if e == vikyscript.ErrNoMatch {
+		return fail(C.VS_NO_MATCH, e.Error())
+	} else if e != nil {
+		return fail(C.VS_ERROR, e.Error())
+	}
+	out := (*C.vs_result)(C.calloc(1, C.size_t(unsafe.Sizeof(C.vs_result{}))))
+	out.command = C.CString(m.Command)
+	out.param_count = C.int(len(m.Params))
+	names := make([]string, len(m.Params))
+	values := make([]string, len(m.Params))
+	for i, p := range m.Params {
+		names[i], values[i] = p.Name, p.Value
+	}
+	out.param_names, out.param_values = cStrings(names), cStrings(values)
+	out.type_error_count = C.int(len(m.TypeErrors))
+	if len(m.TypeErrors) > 0 {
+		out.type_errors = (*C.int)(C.malloc(C.size_t(len(m.TypeErrors)) * C.size_t(unsafe.Sizeof(C.int(0)))))
+		typeErrors := (*[maxArray]C.int)(unsafe.Pointer(out.type_errors))[:len(m.TypeErrors):len(m.TypeErrors)]
+		for i, index := range m.TypeErrors {
+			typeErrors[i] = C.int(index)
+		}
+	}
+	out.score = C.double(m.Score)
+	*res = out
+	return C.VS_OK
+}
+
+// vs_commands returns the names of the commands of the recognizer with the
+// given handle as a NULL-terminated array, in alphabetical order, or NULL if
+// the handle is invalid. The array must be released with vs_free_strings.
+//
+//export vs_commands
+func vs_commands(handle C.int) **C.char {
+	r := lookup(handle)
+	if r == nil {
+		return nil
+	}
+	names := r.List()
+	sort.Strings(names)
+	return cStrings(names)
+}
+
+// vs_params returns the names of the parameters of the command with the given
+// name as a NULL-terminated array, in order of appearance, or NULL if there is
+// no such command. The array must be released with vs_free_strings.
+//
+//export vs_params
+func vs_params(handle C.int, command *C.char) **C.char {
+	r := lookup(handle)
+	if r == nil {
+		return nil
+	}
+	m, ok := r.Lookup(C.GoString(command))
+	if !ok {
+		return nil
+	}
+	d, ok := m.(vikyscript.Describer)
+	if !ok {
+		return nil
+	}
+	names, _ := d.Signature()
+	return cStrings(names)
+}
+
+// cStrings returns a NULL-terminated array of copies of ss, allocated in C
+// memory.
+func cStrings(ss []string) **C.char {
+	p := (**C.char)(C.malloc(C.size_t(len(ss)+1) * C.size_t(unsafe.Sizeof((*C.char)(nil)))))
+	a := (*[maxArray]*C.char)(unsafe.Pointer(p))[: len(ss)+1 : len(ss)+1]
+	for i, s := range ss {
+		a[i] = C.CString(s)
+	}
+	a[len(ss)] = nil
+	return p
+}
+
+// vs_free releases a string returned by the library.
+//
+//export vs_free
+func vs_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+// vs_free_strings releases a NULL-terminated array of strings returned by the
+// library.
+//
+//export vs_free_strings
+func vs_free_strings(p **C.char) {
+	if p == nil {
+		return
+	}
+	for a, i := (*[maxArray]*C.char)(unsafe.Pointer(p)), 0; a[i] != nil; i++ {
+		C.free(unsafe.Pointer(a[i]))
+	}
+	C.free(unsafe.Pointer(p))
+}
+
+// vs_free_result releases a result returned by the library.
+//
+//export vs_free_result
+func vs_free_result(res *C.vs_result) {
+	if res == nil {
+		return
+	}
+	C.free(unsafe.Pointer(res.command))
+	vs_free_strings(res.param_names)
+	vs_free_strings(res.param_values)
+	C.free(unsafe.Pointer(res.type_errors))
+	C.free(unsafe.Pointer(res))
+}
+
+func main() {}
@@ -0,0 +1,322 @@
+"""Tests of the Python binding of VikyScript.
+
+Run them from this directory with
+
+    python3 -m unittest test_vikyscript
+
+The shared library is built in a temporary directory, unless the
+VIKYSCRIPT_LIBRARY environment variable points to one already built.
+"""
+import ctypes
+import os
+import shutil
+import subprocess
+import tempfile
+import unittest
+
+import vikyscript
+
+SCRIPT = """
+// Commands of language_definition.md
+volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer=10} ?percent))
+shoppingList: [action:add,remove,delete] {what} [to,from] {when:date} * shopping list
+setVolume: set volume to {level:integer} percent
+"""
+
+_build_dir = None
+
+
+def setUpModule():
+    global _build_dir
+    if os.environ.get("VIKYSCRIPT_LIBRARY"):
+        return
+    _build_dir = tempfile.mkdtemp()
+    path = os.path.join(_build_dir, "libvikyscript.so")
+    here = os.path.dirname(os.path.abspath(__file__))
+    subprocess.check_call(
+        ["go", "build", "-buildmode=c-shared", "-o", path, "."], cwd=here)
+    os.environ["VIKYSCRIPT_LIBRARY"] = path
+
+
+def tearDownModule():
+    if _build_dir:
+        shutil.rmtree(_build_dir)
+
+
+class RecognizerTest(unittest.TestCase):
+
+    def setUp(self):
+        self.recognizer = vikyscript.Recognizer(SCRIPT)
+
+    def tearDown(self):
+        self.recognizer.close()
+
+    def test_match(self):
+        m = self.recognizer.match("Increase the volume of twenty percent")
+        self.assertEqual(m.command, "volumeHandler")
+        self.assertEqual(m.params, [("what", "increase"), ("percentage", "20")])
+        self.assertEqual(m.type_error, [])
+        self.assertGreater(m.score, 0)
+
+    def test_default(self):
+        m = self.recognizer.match("Lower the volume")
+        self.assertEqual(m.args, ["lower", "10"])
+
+    def test_type_error(self):
+        m = self.recognizer.match("Set volume to a lot percent")
+        self.assertEqual(m.command, "setVolume")
+        self.assertEqual(m.args, ["a lot"])
+        self.assertEqual(m.type_error, [0])
+
+    def test_no_match(self):
+        with self.assertRaises(vikyscript.NoMatch):
+            self.recognizer.match("potatoes remove from Wednesday's shopping list")
+
+    def test_call(self):
+        calls = []
+
+        def shoppingList(action, what, when, type_error):
+            calls.append((action, what, type_error))
+            return "done"
+
+        m = self.recognizer.match("Add milk to someday's shopping list")
+        self.assertEqual(m.call(shoppingList), "done")
+        self.assertEqual(calls, [("add", "milk", [2])])
+
+    def test_commands(self):
+        self.assertEqual(self.recognizer.commands(),
+                         ["setVolume", "shoppingList", "volumeHandler"])
+        self.assertEqual(self.recognizer.params("shoppingList"),
+                         ["action", "what", "when"])
+        self.assertEqual(self.recognizer.params("setVolume"), ["level"])
+        with self.assertRaises(KeyError):
+            self.recognizer.params("greet")
+
+    def test_unicode(self):
+        r = vikyscript.Recognizer("greet: salut à tous")
+        try:
+            self.assertEqual(r.match("Salut à tous").command, "greet")
+        finally:
+            r.close()
+
+    def test_invalid_script(self):
+        with self.assertRaises(vikyscript.VikyScriptError) as cm:
+            vikyscript.Recognizer("command: {bar} foo")
+        self.assertIn("cannot start with a parameter", str(cm.exception))
+
+    def test_closed(self):
+        self.recognizer.close()
+        with self.assertRaises(vikyscript.VikyScriptError):
+            self.recognizer.match("Lower the volume")
+
+    def test_context_manager(self):
+        with vikyscript.Recognizer(SCRIPT) as r:
+            self.assertEqual(r.match("Lower the volume").command, "volumeHandler")
+        self.assertFalse(r._handle)
+
+
+class Handlers(object):
+    """Handlers of the commands of SCRIPT, recording their calls."""
+
+    def __init__(self):
+        self.calls = []
+
+    def volumeHandler(self, what, percentage, type_error):
+        self.calls.append(("volumeHandler", what, percentage, type_error))
+        return "volume"
+
+    def shoppingList(self, action, what, when, type_error):
+        self.calls.append(("shoppingList", action, what, type_error))
+        return "shopping"
+
+    def setVolume(self, *args):
+        self.calls.append(("setVolume",) + args)
+        return "set"
+
+
+class DispatchTest(unittest.TestCase):
+
+    def test_dispatch(self):
+        handlers = Handlers()
+        with vikyscript.Recognizer(SCRIPT, handlers) as r:
+            self.assertEqual(r.dispatch("Lower the volume"), "volume")
+            self.assertEqual(r.dispatch("Add milk to someday's shopping list"), "shopping")
+            self.assertEqual(r.dispatch("Set volume to ten percent"), "set")
+            with self.assertRaises(vikyscript.NoMatch):
+                r.dispatch("turn on the lights")
+        self.assertEqual(handlers.calls, [
+            ("volumeHandler", "lower", "10", []),
+            ("shoppingList", "add", "milk", [2]),
+            ("setVolume", "10", []),
+        ])
+
+    def test_mapping(self):
+        calls = []
+
+        def greet(type_error):
+            calls.append(type_error)
+
+        with vikyscript.Recognizer("greet: hello *", {"greet": greet}) as r:
+            r.dispatch("hello there")
+        self.assertEqual(calls, [[]])
+
+    def test_defaults(self):
+        def volumeHandler(what, percentage="10", type_error=None, verbose=False):
+            return what, percentage
+
+        r = vikyscript.Recognizer(
+            "volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer} ?percent))",
+            {"volumeHandler": volumeHandler})
+        with r:
+            self.assertEqual(r.dispatch("Increase the volume"), ("increase", ""))
+
+    def test_not_bound(self):
+        with vikyscript.Recognizer(SCRIPT) as r:
+            with self.assertRaises(vikyscript.VikyScriptError):
+                r.dispatch("Lower the volume")
+
+    def test_invalid_handlers(self):
+        def three(a, b, type_error):
+            pass
+
+        def two(a, type_error):
+            pass
+
+        for name, handlers in [
+            ("missing", {"volumeHandler": three, "shoppingList": lambda *a: None}),
+            ("notcallable", {"volumeHandler": three, "shoppingList": three, "setVolume": "set"}),
+            ("fewargs", {"volumeHandler": two, "shoppingList": three, "setVolume": two}),
+            ("manyargs", {"volumeHandler": three, "shoppingList": three, "setVolume": three}),
+            ("notypeerror", {"volumeHandler": three, "shoppingList": lambda a, b, c: None,
+                             "setVolume": two}),
+        ]:
+            with self.assertRaises(vikyscript.VikyScriptError, msg=name):
+                vikyscript.Recognizer(SCRIPT, handlers)
+
+    def test_error_message(self):
+        with self.assertRaises(vikyscript.VikyScriptError) as cm:
+            vikyscript.Recognizer(SCRIPT, {})
+        for command in ["setVolume", "shoppingList", "volumeHandler"]:
+            self.assertIn("no handler for command %r" % command, str(cm.exception))
+
+
+class Result(ctypes.Structure):
+    """The vs_result struct of vikyscript.h."""
+    _fields_ = [
+        ("command", ctypes.c_char_p),
+        ("param_count", ctypes.c_int),
+        ("param_names", ctypes.POINTER(ctypes.c_char_p)),
+        ("param_values", ctypes.POINTER(ctypes.c_char_p)),
+        ("type_error_count", ctypes.c_int),
+        ("type_errors", ctypes.POINTER(ctypes.c_int)),
+        ("score", ctypes.c_double),
+    ]
+
+
+class CInterfaceTest(unittest.TestCase):
+    """Tests the functions of vikyscript.h that the binding does not use."""
+
+    def setUp(self):
+        self.lib = ctypes.CDLL(os.environ["VIKYSCRIPT_LIBRARY"])
+        self.lib.vs_load.argtypes = [ctypes.c_char_p, ctypes.POINTER(ctypes.c_void_p)]
+        self.lib.vs_match_result.argtypes = [
+            ctypes.c_int, ctypes.c_char_p,
+            ctypes.POINTER(ctypes.POINTER(Result)), ctypes.POINTER(ctypes.c_void_p)]
+        self.lib.vs_free_result.argtypes = [ctypes.POINTER(Result)]
+        self.lib.vs_free.argtypes = [ctypes.c_void_p]
+        self.handle = self.lib.vs_load(SCRIPT.encode("utf-8"), None)
+        self.assertTrue(self.handle)
+
+    def tearDown(self):
+        self.lib.vs_unload(self.handle)
+
+    def match(self, text):
+        res = ctypes.POINTER(Result)()
+        err = ctypes.c_void_p()
+        code = self.lib.vs_match_result(
+            self.handle, text.encode("utf-8"), ctypes.byref(res), ctypes.byref(err))
+        if err.value:
+            self.lib.vs_free(err)
+        return code, res
+
+    def test_match_result(self):
+        code, res = self.match("Add milk to someday's shopping list")
+        self.assertEqual(code, 0)
+        try:
+            r = res.contents
+            self.assertEqual(r.command, b"shoppingList")
+            self.assertEqual(r.param_count, 3)
+            self.assertEqual([r.param_names[i] for i in range(4)],
+                             [b"action", b"what", b"when", None])
+            self.assertEqual([r.param_values[i] for i in range(4)],
+                             [b"add", b"milk", b"someday's", None])
+            self.assertEqual(r.type_error_count, 1)
+            self.assertEqual(r.type_errors[0], 2)
+            self.assertGreater(r.score, 0)
+        finally:
+            self.lib.vs_free_result(res)
+
+    def test_match_result_errors(self):
+        code, res = self.match("turn on the lights")
+        self.assertEqual(code, 1)
+        self.assertFalse(res)
+        self.lib.vs_unload(self.handle)
+        code, res = self.match("Lower the volume")
+        self.assertEqual(code, 2)
+        self.assertFalse(res)
+
+    def test_header(self):
+        cc = shutil.which("cc")
+        if cc is None:
+            self.skipTest("no C compiler")
+        here = os.path.dirname(os.path.abspath(__file__))
+        lib = os.environ["VIKYSCRIPT_LIBRARY"]
+        with tempfile.TemporaryDirectory() as tmp:
+            src = os.path.join(tmp, "main.c")
+            with open(src, "w") as f:
+                f.write(C_PROGRAM)
+            prog = os.path.join(tmp, "main")
+            subprocess.check_call(
+                [cc, "-Wall", "-Werror", "-I", here, "-o", prog, src, lib])
+            out = subprocess.check_output(
+                [prog], env=dict(os.environ, LD_LIBRARY_PATH=os.path.dirname(lib)))
+        self.assertEqual(out.decode("utf-8").split("\n"), [
+            "setVolume", "shoppingList", "volumeHandler",
+            "setVolume level=a lot errors=1", ""])
+
+
+C_PROGRAM = r"""
+#include <stdio.h>
+#include "vikyscript.h"
+
+int main(void) {
+	char *err = NULL;
+	int h = vs_load("setVolume: set volume to {level:integer} percent\n"
+			"volumeHandler: #([what:increase,decrease] * volume)\n"
+			"shoppingList: [action:add,remove] {what} [to,from] {when:date} * shopping list", &err);
+	if (!h) {
+		fprintf(stderr, "%s\n", err);
+		vs_free(err);
+		return 1;
+	}
+	char **names = vs_commands(h);
+	for (char **p = names; *p; p++) {
+		printf("%s\n", *p);
+	}
+	vs_free_strings(names);
+	vs_result *res;
+	if (vs_match_result(h, "set volume to a lot percent", &res, &err) != VS_OK) {
+		fprintf(stderr, "%s\n", err);
+		vs_free(err);
+		return 1;
+	}
+	printf("%s %s=%s errors=%d\n", res->command, res->param_names[0], res->param_values[0], res->type_error_count);
+	vs_free_result(res);
+	vs_unload(h);
+	return 0;
+}
+"""
+
+
+if __name__ == "__main__":
+    unittest.main()
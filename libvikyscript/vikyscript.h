@@ -0,0 +1,88 @@
+/*
+ * vikyscript.h is the stable C interface of libvikyscript, the shared library
+ * built from this directory with
+ *
+ *	go build -buildmode=c-shared -o libvikyscript.so ./libvikyscript
+ *
+ * Unlike the header generated by cgo alongside the library, it only uses
+ * plain C types, and does not change when the library is rebuilt.
+ *
+ * Recognizers are referred to by handles. Everything returned by the library
+ * is owned by the caller, and must be released with the free routine of its
+ * type: vs_free for strings, vs_free_strings for arrays of strings and
+ * vs_free_result for results.
+ */
+#ifndef VIKYSCRIPT_H
+#define VIKYSCRIPT_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/* Return codes of vs_match_result. */
+#define VS_OK 0       /* A command was matched. */
+#define VS_NO_MATCH 1 /* No command matched. */
+#define VS_ERROR 2    /* The handle is invalid, or no command could be chosen. */
+
+/* vs_result is the outcome of a successful match. */
+typedef struct vs_result {
+	char *command;        /* The name of the matched command. */
+	int param_count;      /* The number of parameters. */
+	char **param_names;   /* The names of the parameters, in order of appearance; NULL-terminated. */
+	char **param_values;  /* The values of the parameters; NULL-terminated. */
+	int type_error_count; /* The number of parameters whose type conversion failed. */
+	int *type_errors;     /* Their indexes in param_names; NULL if there are none. */
+	double score;         /* The confidence of the match, between 0 and 1. */
+} vs_result;
+
+/*
+ * vs_load compiles script and returns the handle of the recognizer, which must
+ * be released with vs_unload. It returns 0 and sets *err, if err is not NULL,
+ * if the script is invalid.
+ */
+int vs_load(char *script, char **err);
+
+/* vs_unload releases the recognizer with the given handle. */
+void vs_unload(int handle);
+
+/*
+ * vs_match matches text and returns the result as a JSON object, either
+ * {"command": "...", "params": [{"name": "...", "value": "..."}],
+ * "type_errors": [0], "score": 0.5}, or {"error": "...", "no_match": true}
+ * if no command matched, or {"error": "..."} if no command could be chosen.
+ */
+char *vs_match(int handle, char *text);
+
+/*
+ * vs_match_result matches text and sets *res to the result. It returns
+ * VS_OK on success, and otherwise a different code and sets *err, if err is
+ * not NULL.
+ */
+int vs_match_result(int handle, char *text, vs_result **res, char **err);
+
+/*
+ * vs_commands returns the names of the commands of the recognizer with the
+ * given handle, in alphabetical order, or NULL if the handle is invalid.
+ */
+char **vs_commands(int handle);
+
+/*
+ * vs_params returns the names of the parameters of the command with the given
+ * name, in order of appearance, or NULL if there is no such command.
+ */
+char **vs_params(int handle, char *command);
+
+/* vs_free releases a string returned by the library. */
+void vs_free(char *s);
+
+/* vs_free_strings releases a NULL-terminated array of strings returned by the library. */
+void vs_free_strings(char **strings);
+
+/* vs_free_result releases a result returned by the library. */
+void vs_free_result(vs_result *res);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* VIKYSCRIPT_H */
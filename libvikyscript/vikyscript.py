@@ -0,0 +1,234 @@
+"""Python binding of VikyScript.
+
+The binding loads libvikyscript, the C shared library built from this
+directory with
+
+    go build -buildmode=c-shared -o libvikyscript.so ./libvikyscript
+
+The library is looked for in the path set in the VIKYSCRIPT_LIBRARY
+environment variable, or else next to this module.
+
+Usage:
+
+    r = Recognizer(open("commands.vs").read())
+    m = r.match("Increase the volume of ten percent")
+    m.call(volumeHandler)  # volumeHandler("increase", "10", [])
+
+Handlers can be looked up by command name in a module or any other object:
+
+    import handlers
+    r = Recognizer(open("commands.vs").read(), handlers)
+    r.dispatch("Increase the volume of ten percent")
+"""
+import collections.abc
+import ctypes
+import inspect
+import json
+import os
+
+_lib = None
+
+
+def _library():
+    """Loads the shared library once and declares its functions."""
+    global _lib
+    if _lib is None:
+        path = os.environ.get("VIKYSCRIPT_LIBRARY") or os.path.join(
+            os.path.dirname(os.path.abspath(__file__)), "libvikyscript.so")
+        lib = ctypes.CDLL(path)
+        # Strings returned by the library are kept as pointers, so that they
+        # can be released once copied.
+        lib.vs_load.argtypes = [ctypes.c_char_p, ctypes.POINTER(ctypes.c_void_p)]
+        lib.vs_load.restype = ctypes.c_int
+        lib.vs_unload.argtypes = [ctypes.c_int]
+        lib.vs_unload.restype = None
+        lib.vs_match.argtypes = [ctypes.c_int, ctypes.c_char_p]
+        lib.vs_match.restype = ctypes.c_void_p
+        lib.vs_commands.argtypes = [ctypes.c_int]
+        lib.vs_commands.restype = ctypes.POINTER(ctypes.c_char_p)
+        lib.vs_params.argtypes = [ctypes.c_int, ctypes.c_char_p]
+        lib.vs_params.restype = ctypes.POINTER(ctypes.c_char_p)
+        lib.vs_free.argtypes = [ctypes.c_void_p]
+        lib.vs_free.restype = None
+        lib.vs_free_strings.argtypes = [ctypes.POINTER(ctypes.c_char_p)]
+        lib.vs_free_strings.restype = None
+        _lib = lib
+    return _lib
+
+
+def _take_string(lib, ptr):
+    """Copies a string returned by the library, and releases it."""
+    try:
+        return ctypes.string_at(ptr).decode("utf-8")
+    finally:
+        lib.vs_free(ptr)
+
+
+def _take_strings(lib, array):
+    """Copies a NULL-terminated array of strings returned by the library, and
+    releases it. It returns None if array is NULL."""
+    if not array:
+        return None
+    try:
+        strings = []
+        while array[len(strings)] is not None:
+            strings.append(array[len(strings)].decode("utf-8"))
+        return strings
+    finally:
+        lib.vs_free_strings(array)
+
+
+class VikyScriptError(Exception):
+    """Raised when a script is invalid or a sentence cannot be matched."""
+
+
+class NoMatch(VikyScriptError):
+    """Raised when no command matches a sentence."""
+
+
+class Match(object):
+    """The outcome of a successful match.
+
+    params holds the (name, value) pairs of the parameters in order of
+    appearance in the command, and type_error the indexes of the parameters
+    whose type conversion failed.
+    """
+
+    def __init__(self, command, params, type_error, score):
+        self.command = command
+        self.params = params
+        self.type_error = type_error
+        self.score = score
+
+    @property
+    def args(self):
+        """The values of the parameters, in order of appearance."""
+        return [value for _, value in self.params]
+
+    def call(self, handler):
+        """Calls handler as described in language_definition.md: with the
+        values of the parameters in order of appearance followed by the
+        type_error list, and returns its result."""
+        return handler(*(self.args + [self.type_error]))
+
+    def __repr__(self):
+        return "Match(%r, %r, %r, %r)" % (
+            self.command, self.params, self.type_error, self.score)
+
+
+class Recognizer(object):
+    """Matches sentences against the commands defined in a script.
+
+    If handlers is given, it is bound to the recognizer as by bind.
+    """
+
+    def __init__(self, script, handlers=None):
+        self._lib = _library()
+        self._handlers = None
+        err = ctypes.c_void_p()
+        self._handle = self._lib.vs_load(script.encode("utf-8"), ctypes.byref(err))
+        if not self._handle:
+            raise VikyScriptError(_take_string(self._lib, err.value))
+        if handlers is not None:
+            try:
+                self.bind(handlers)
+            except Exception:
+                self.close()
+                raise
+
+    def bind(self, handlers):
+        """Binds the commands to their handlers, the functions with the same
+        name found in handlers: a module, any other object, or a mapping.
+
+        Every command must have a handler that can be called with the values
+        of its parameters followed by the type_error list, as positional
+        arguments. VikyScriptError is raised, and no handler is bound,
+        otherwise.
+        """
+        bound = {}
+        errors = []
+        for command in self.commands():
+            if isinstance(handlers, collections.abc.Mapping):
+                handler = handlers.get(command)
+            else:
+                handler = getattr(handlers, command, None)
+            if handler is None:
+                errors.append("no handler for command %r" % command)
+                continue
+            if not callable(handler):
+                errors.append("handler of command %r is not callable" % command)
+                continue
+            params = self.params(command)
+            args = params + ["type_error"]
+            try:
+                inspect.signature(handler).bind(*args)
+            except TypeError as e:
+                errors.append("handler of command %r cannot be called as %s(%s): %s"
+                              % (command, command, ", ".join(args), e))
+                continue
+            except ValueError:
+                # The signature of some builtins cannot be inspected.
+                pass
+            bound[command] = handler
+        if errors:
+            raise VikyScriptError("; ".join(errors))
+        self._handlers = bound
+
+    def dispatch(self, text):
+        """Matches text, calls the handler of the matched command as
+        Match.call does, and returns its result. It raises the errors of
+        match, and VikyScriptError if no handlers are bound."""
+        if self._handlers is None:
+            raise VikyScriptError("no handlers bound")
+        m = self.match(text)
+        return m.call(self._handlers[m.command])
+
+    def match(self, text):
+        """Returns the Match of text. It raises NoMatch if no command
+        matches, and VikyScriptError if no command can be chosen."""
+        self._check()
+        res = json.loads(_take_string(
+            self._lib, self._lib.vs_match(self._handle, text.encode("utf-8"))))
+        if "error" in res:
+            if res.get("no_match"):
+                raise NoMatch(text)
+            raise VikyScriptError(res["error"])
+        return Match(res["command"],
+                     [(p["name"], p["value"]) for p in res.get("params", [])],
+                     res.get("type_errors", []),
+                     res.get("score", 0.0))
+
+    def commands(self):
+        """Returns the names of the commands, in alphabetical order."""
+        self._check()
+        return _take_strings(self._lib, self._lib.vs_commands(self._handle))
+
+    def params(self, command):
+        """Returns the names of the parameters of command, in order of
+        appearance. It raises KeyError if there is no such command."""
+        self._check()
+        names = _take_strings(
+            self._lib, self._lib.vs_params(self._handle, command.encode("utf-8")))
+        if names is None:
+            raise KeyError(command)
+        return names
+
+    def _check(self):
+        if not self._handle:
+            raise VikyScriptError("recognizer is closed")
+
+    def close(self):
+        """Releases the recognizer."""
+        if self._handle:
+            self._lib.vs_unload(self._handle)
+            self._handle = 0
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *exc):
+        self.close()
+
+    def __del__(self):
+        if getattr(self, "_handle", 0):
+            self.close()
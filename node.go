@@ -3,6 +3,7 @@ package vikyscript
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 var textFormat = "%s" // Changed to "%q" in tests for better error messages.
@@ -71,7 +72,10 @@ func (l *ListNode) tree() *Tree {
 
 func (l *ListNode) String() string {
 	b := new(bytes.Buffer)
-	for _, n := range l.Nodes {
+	for i, n := range l.Nodes {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
 		fmt.Fprint(b, n)
 	}
 	return b.String()
@@ -115,3 +119,251 @@ func (t *TextNode) tree() *Tree {
 func (t *TextNode) Copy() Node {
 	return &TextNode{tr: t.tr, NodeType: NodeWord, Pos: t.Pos, Text: append([]byte{}, t.Text...)}
 }
+
+// IgnoreNode represents the * operator: words that are not relevant.
+type IgnoreNode struct {
+	NodeType
+	Pos
+	tr *Tree
+}
+
+func (t *Tree) newIgnore(pos Pos) *IgnoreNode {
+	return &IgnoreNode{tr: t, NodeType: NodeIgnore, Pos: pos}
+}
+
+func (i *IgnoreNode) String() string {
+	return "*"
+}
+
+func (i *IgnoreNode) tree() *Tree {
+	return i.tr
+}
+
+func (i *IgnoreNode) Copy() Node {
+	return i.tr.newIgnore(i.Pos)
+}
+
+// OptionalNode represents the ? operator: the wrapped block may not be present.
+type OptionalNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Node Node // Either a *TextNode or a *ParenNode.
+}
+
+func (t *Tree) newOptional(pos Pos, n Node) *OptionalNode {
+	return &OptionalNode{tr: t, NodeType: NodeOptional, Pos: pos, Node: n}
+}
+
+func (o *OptionalNode) String() string {
+	return "?" + o.Node.String()
+}
+
+func (o *OptionalNode) tree() *Tree {
+	return o.tr
+}
+
+func (o *OptionalNode) CopyOptional() *OptionalNode {
+	if o == nil {
+		return o
+	}
+	return o.tr.newOptional(o.Pos, o.Node.Copy())
+}
+
+func (o *OptionalNode) Copy() Node {
+	return o.CopyOptional()
+}
+
+// ShuffleNode represents the # operator: the order of the blocks in List
+// does not matter.
+type ShuffleNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	List *ListNode
+}
+
+func (t *Tree) newShuffle(pos Pos, list *ListNode) *ShuffleNode {
+	return &ShuffleNode{tr: t, NodeType: NodeShuffle, Pos: pos, List: list}
+}
+
+func (s *ShuffleNode) String() string {
+	return fmt.Sprintf("#(%s)", s.List)
+}
+
+func (s *ShuffleNode) tree() *Tree {
+	return s.tr
+}
+
+func (s *ShuffleNode) CopyShuffle() *ShuffleNode {
+	if s == nil {
+		return s
+	}
+	return s.tr.newShuffle(s.Pos, s.List.CopyList())
+}
+
+func (s *ShuffleNode) Copy() Node {
+	return s.CopyShuffle()
+}
+
+// ParenNode holds a parenthesized sequence of blocks.
+type ParenNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	List *ListNode
+}
+
+func (t *Tree) newParen(pos Pos, list *ListNode) *ParenNode {
+	return &ParenNode{tr: t, NodeType: NodeParen, Pos: pos, List: list}
+}
+
+func (p *ParenNode) String() string {
+	return fmt.Sprintf("(%s)", p.List)
+}
+
+func (p *ParenNode) tree() *Tree {
+	return p.tr
+}
+
+func (p *ParenNode) CopyParen() *ParenNode {
+	if p == nil {
+		return p
+	}
+	return p.tr.newParen(p.Pos, p.List.CopyList())
+}
+
+func (p *ParenNode) Copy() Node {
+	return p.CopyParen()
+}
+
+// NamedListNode holds a list of synonyms. Name is empty for unnamed lists.
+type NamedListNode struct {
+	NodeType
+	Pos
+	tr     *Tree
+	Name   string   // The name of the list, passed as a parameter to the handler.
+	Words  []string // The synonyms, in lexical order.
+	Values []string // The values given to the synonyms; empty if omitted.
+}
+
+func (t *Tree) newNamedList(pos Pos, name string) *NamedListNode {
+	return &NamedListNode{tr: t, NodeType: NodeListWord, Pos: pos, Name: name}
+}
+
+// Value returns the value passed to the handler when the i-th synonym
+// matches: the value given to it, or else the synonym itself, with its
+// whitespace normalized as in names.
+func (l *NamedListNode) Value(i int) string {
+	if l.Values[i] != "" {
+		return normalizeName(l.Values[i])
+	}
+	return normalizeName(l.Words[i])
+}
+
+func (l *NamedListNode) String() string {
+	// Consecutive synonyms with the same value are written together.
+	var entries []string
+	for i := 0; i < len(l.Words); {
+		j := i + 1
+		for l.Values[i] != "" && j < len(l.Words) && l.Values[j] == l.Values[i] {
+			j++
+		}
+		entry := strings.Join(l.Words[i:j], "|")
+		if l.Values[i] != "" {
+			entry += "=" + l.Values[i]
+		}
+		entries = append(entries, entry)
+		i = j
+	}
+	words := strings.Join(entries, ",")
+	if l.Name == "" {
+		return fmt.Sprintf("[%s]", words)
+	}
+	return fmt.Sprintf("[%s:%s]", l.Name, words)
+}
+
+func (l *NamedListNode) tree() *Tree {
+	return l.tr
+}
+
+func (l *NamedListNode) CopyNamedList() *NamedListNode {
+	if l == nil {
+		return l
+	}
+	n := l.tr.newNamedList(l.Pos, l.Name)
+	n.Words = append([]string{}, l.Words...)
+	n.Values = append([]string{}, l.Values...)
+	return n
+}
+
+func (l *NamedListNode) Copy() Node {
+	return l.CopyNamedList()
+}
+
+// ParamNode holds a parameter and its optional type.
+type ParamNode struct {
+	NodeType
+	Pos
+	tr      *Tree
+	Name    string // The name of the parameter.
+	Typ     string // The type of the parameter; empty if omitted.
+	Default string // The value of the parameter when it is missing; empty if omitted.
+}
+
+func (t *Tree) newParam(pos Pos, name, typ string) *ParamNode {
+	return &ParamNode{tr: t, NodeType: NodeParam, Pos: pos, Name: name, Typ: typ}
+}
+
+func (p *ParamNode) String() string {
+	s := p.Name
+	if p.Typ != "" {
+		s += ":" + p.Typ
+	}
+	if p.Default != "" {
+		s += "=" + p.Default
+	}
+	return fmt.Sprintf("{%s}", s)
+}
+
+func (p *ParamNode) tree() *Tree {
+	return p.tr
+}
+
+func (p *ParamNode) CopyParam() *ParamNode {
+	if p == nil {
+		return p
+	}
+	n := p.tr.newParam(p.Pos, p.Name, p.Typ)
+	n.Default = p.Default
+	return n
+}
+
+func (p *ParamNode) Copy() Node {
+	return p.CopyParam()
+}
+
+// Walk traverses the nodes rooted at n in depth-first order, calling fn for
+// each of them. If fn returns false the children of the node are skipped.
+// The lists held by ShuffleNode and ParenNode are not visited themselves:
+// their elements are visited as direct children of the node, which matches
+// the way commands are usually depicted.
+func Walk(n Node, fn func(Node) bool) {
+	if !fn(n) {
+		return
+	}
+	var children []Node
+	switch n := n.(type) {
+	case *ListNode:
+		children = n.Nodes
+	case *OptionalNode:
+		children = []Node{n.Node}
+	case *ShuffleNode:
+		children = n.List.Nodes
+	case *ParenNode:
+		children = n.List.Nodes
+	}
+	for _, c := range children {
+		Walk(c, fn)
+	}
+}
@@ -0,0 +1,62 @@
+package vikyscript
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const volumeCommand = "volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer} ?percent))"
+
+func TestCopy(t *testing.T) {
+	treeSet, err := Parse("copy", volumeCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := treeSet["volumeHandler"]
+	cp := tree.Copy()
+	if got, exp := cp.Root.String(), tree.Root.String(); got != exp {
+		t.Fatalf("copy differs: got %q expected %q", got, exp)
+	}
+	// Mutating the copy must not affect the original.
+	shuffle := cp.Root.Nodes[0].(*ShuffleNode)
+	shuffle.List.Nodes[0].(*NamedListNode).Words[0] = "raise"
+	shuffle.List.Nodes[3].(*OptionalNode).Node.(*ParenNode).List.Nodes[1].(*ParamNode).Typ = "string"
+	if got, exp := tree.Root.String(), cp.Root.String(); got == exp {
+		t.Errorf("copy shares state with the original: %q", got)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	treeSet, err := Parse("walk", volumeCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same structure as parsetree.dot.
+	exp := []string{
+		"*vikyscript.ListNode",
+		"*vikyscript.ShuffleNode",
+		"*vikyscript.NamedListNode [what:increase,decrease,lower]",
+		"*vikyscript.IgnoreNode *",
+		"*vikyscript.TextNode volume",
+		"*vikyscript.OptionalNode",
+		"*vikyscript.ParenNode",
+		"*vikyscript.IgnoreNode *",
+		"*vikyscript.ParamNode {percentage:integer}",
+		"*vikyscript.OptionalNode",
+		"*vikyscript.TextNode percent",
+	}
+	var got []string
+	Walk(treeSet["volumeHandler"].Root, func(n Node) bool {
+		switch n.Type() {
+		case NodeList, NodeShuffle, NodeOptional, NodeParen:
+			got = append(got, fmt.Sprintf("%T", n))
+		default:
+			got = append(got, fmt.Sprintf("%T %s", n, n))
+		}
+		return true
+	})
+	if strings.Join(got, "\n") != strings.Join(exp, "\n") {
+		t.Errorf("unexpected walk:\n%s\nexpected:\n%s", strings.Join(got, "\n"), strings.Join(exp, "\n"))
+	}
+}
@@ -1,8 +1,10 @@
 package vikyscript
 
 import (
+	"bytes"
 	"fmt"
 	"runtime"
+	"sort"
 	"strings"
 )
 
@@ -11,6 +13,7 @@ type Tree struct {
 	Name      string    // name of the template represented by the tree.
 	ParseName string    // name of the top-level template during parsing, for error messages.
 	Root      *ListNode // top-level root of the tree.
+	Mode      Mode      // parsing mode.
 	text      string    // text parsed to create the template (or its parent)
 	// Parsing only; cleared after parse.
 	lex       *lexer
@@ -19,6 +22,15 @@ type Tree struct {
 	treeSet   map[string]*Tree
 }
 
+// A mode value is a set of flags (or 0). Modes control parser behavior.
+type Mode uint
+
+const (
+	// OverrideDefinitions makes a command replace the one with the same
+	// name that was parsed before it, instead of causing an error.
+	OverrideDefinitions Mode = 1 << iota
+)
+
 // Copy returns a copy of the Tree. Any parsing state is discarded.
 func (t *Tree) Copy() *Tree {
 	if t == nil {
@@ -28,6 +40,7 @@ func (t *Tree) Copy() *Tree {
 		Name:      t.Name,
 		ParseName: t.ParseName,
 		Root:      t.Root.CopyList(),
+		Mode:      t.Mode,
 		text:      t.text,
 	}
 }
@@ -137,6 +150,13 @@ func (t *Tree) ErrorContext(n Node) (location, context string) {
 	return fmt.Sprintf("%s:%d:%d", tree.ParseName, lineNum, byteNum), context
 }
 
+// nodeErrorf formats an error located at node n and terminates processing.
+func (t *Tree) nodeErrorf(n Node, format string, args ...interface{}) {
+	location, context := t.ErrorContext(n)
+	t.Root = nil
+	panic(fmt.Errorf("template: %s: %s: %s", location, fmt.Sprintf(format, args...), context))
+}
+
 // errorf formats the error and terminates processing.
 func (t *Tree) errorf(format string, args ...interface{}) {
 	t.Root = nil
@@ -168,7 +188,11 @@ func (t *Tree) expectOneOf(expected1, expected2 itemType, context string) item {
 }
 
 // unexpected complains about the token and terminates processing.
+// Errors reported by the lexer are passed through unchanged.
 func (t *Tree) unexpected(token item, context string) {
+	if token.typ == itemError {
+		t.errorf("%s", token.val)
+	}
 	t.errorf("unexpected %s in %s", token, context)
 }
 
@@ -201,66 +225,580 @@ func (t *Tree) stopParse() {
 	t.treeSet = nil
 }
 
-// Parse parses the template definition string to construct a representation of
-// the template for execution. If either action delimiter string is empty, the
-// default ("{{" or "}}") is used. Embedded template definitions are added to
-// the treeSet map.
+// Parse parses the script, one command per line, to construct a representation
+// of its commands. Blank lines and lines starting with "//" or "#" are
+// ignored. Every command is parsed into its own tree, which is added to the
+// treeSet map keyed by the name of the command. The name of t is only used in
+// error messages.
+// Lines starting with "@" define lists, such as "@colors = [red,green]", whose
+// trees are added to treeSet as well, keyed by their name including the "@".
+// Once the whole script is parsed, the references to them in the lists of
+// the trees in treeSet, such as "[color:@colors,black]", are replaced by
+// their synonyms.
 func (t *Tree) Parse(text string, treeSet map[string]*Tree) (tree *Tree, err error) {
 	defer t.recover(&err)
 	t.ParseName = t.Name
 	t.startParse(lex(t.Name, text), treeSet)
 	t.text = text
 	t.parse()
-	t.add()
+	t.resolve()
 	t.stopParse()
 	return t, nil
 }
 
-// add adds tree to t.treeSet.
+// add adds tree to t.treeSet. Defining a command twice is an error unless
+// the OverrideDefinitions mode is set, or one of the definitions is empty.
 func (t *Tree) add() {
 	tree := t.treeSet[t.Name]
-	if tree == nil || IsEmptyTree(tree.Root) {
+	if tree == nil || IsEmptyTree(tree.Root) || (t.Mode&OverrideDefinitions != 0 && !IsEmptyTree(t.Root)) {
 		t.treeSet[t.Name] = t
 		return
 	}
 	if !IsEmptyTree(t.Root) {
-		t.errorf("template: multiple definition of template %q", t.Name)
+		kind := "command"
+		if IsListDefinition(t) {
+			kind = "list"
+		}
+		location, _ := tree.ErrorContext(tree.Root)
+		t.errorf("multiple definition of %s %q, previous definition at %s", kind, t.Name, location)
 	}
 }
 
-// IsEmptyTree reports whether this tree (node) is empty of everything but space.
+// IsEmptyTree reports whether this tree (node) is empty of everything but
+// space, so that it could not match any word.
 func IsEmptyTree(n Node) bool {
-	panic("not implemented")
+	switch n := n.(type) {
+	case nil:
+		return true
+	case *ListNode:
+		if n == nil {
+			return true
+		}
+		for _, node := range n.Nodes {
+			if !IsEmptyTree(node) {
+				return false
+			}
+		}
+		return true
+	case *TextNode:
+		return len(bytes.TrimSpace(n.Text)) == 0
+	case *NamedListNode:
+		for _, w := range n.Words {
+			if strings.TrimSpace(w) != "" {
+				return false
+			}
+		}
+		return true
+	case *OptionalNode:
+		return IsEmptyTree(n.Node)
+	case *ParenNode:
+		return IsEmptyTree(n.List)
+	case *ShuffleNode:
+		return IsEmptyTree(n.List)
+	case *IgnoreNode, *ParamNode:
+		return false
+	default:
+		panic("unknown node: " + n.String())
+	}
 }
 
-// parse is the top-level parser for a template, essentially the same
-// as itemList except it also parses {{define}} actions.
+// parse is the top-level parser for a script. Every command is parsed into
+// a new tree, and added to the tree set.
 // It runs to EOF.
 func (t *Tree) parse() {
-	t.Root = t.newList(t.peek().pos)
-	for t.peek().typ != itemEOF {
-		/*
-			if t.peek().typ == itemLeftDelim {
-				delim := t.next()
-				if t.nextNonSpace().typ == itemDefine {
-					newT := New("definition") // name will be updated once we know it.
-					newT.text = t.text
-					newT.ParseName = t.ParseName
-					newT.startParse(t.funcs, t.lex, t.treeSet)
-					newT.parseDefinition()
+	for {
+		switch token := t.nextNonSpace(); token.typ {
+		case itemEOF:
+			return
+		case itemNewline:
+		case itemCommandName:
+			newT := t.newTree(normalizeName(token.val), token)
+			end := newT.parseDefinition()
+			newT.check()
+			newT.add()
+			newT.stopParse()
+			if end.typ == itemEOF {
+				return
+			}
+		case itemDefinition:
+			newT := t.newTree(string(listRef)+normalizeName(token.val), token)
+			end := newT.parseListDefinition()
+			newT.add()
+			newT.stopParse()
+			if end.typ == itemEOF {
+				return
+			}
+		default:
+			t.unexpected(token, "script")
+		}
+	}
+}
+
+// newTree returns the tree of a command or list definition named name found
+// while parsing t. The token holding the name counts as read, so that errors
+// found before the next one is report its line.
+func (t *Tree) newTree(name string, token item) *Tree {
+	newT := New(name)
+	newT.Mode = t.Mode
+	newT.text = t.text
+	newT.ParseName = t.ParseName
+	newT.startParse(t.lex, t.treeSet)
+	newT.token[0] = token
+	return newT
+}
+
+// parseDefinition parses the body of a command up to the end of its line.
+// It returns the item terminating the command, either a newline or EOF.
+// The name of the command has been scanned.
+func (t *Tree) parseDefinition() item {
+	if t.Name == "" {
+		t.errorf("missing command name")
+	}
+	t.expect(itemColon, "command")
+	t.Root = t.newList(t.peekNonSpace().pos)
+	for {
+		switch t.peekNonSpace().typ {
+		case itemEOF, itemNewline:
+			if len(t.Root.Nodes) == 0 {
+				t.errorf("empty command %q", t.Name)
+			}
+			return t.nextNonSpace()
+		}
+		t.Root.append(t.block())
+	}
+}
+
+// parseListDefinition parses a list definition up to the end of its line.
+//
+//	@name = [word,word]
+//
+// It returns the item terminating the definition, either a newline or EOF.
+// The name of the list has been scanned.
+func (t *Tree) parseListDefinition() item {
+	t.expect(itemEquals, "list definition")
+	if t.Name == string(listRef) {
+		t.errorf("missing list name")
+	}
+	left := t.expect(itemLeftList, "list definition")
+	list := t.list(left)
+	if list.Name != "" {
+		t.errorf("list definition %q cannot name its list", t.Name)
+	}
+	t.Root = t.newList(left.pos)
+	t.Root.append(list)
+	token := t.nextNonSpace()
+	if token.typ != itemEOF && token.typ != itemNewline {
+		t.unexpected(token, "list definition")
+	}
+	return token
+}
+
+// resolve replaces the references to list definitions in the lists of the
+// tree set with the synonyms of the lists they refer to, in order of name of
+// the trees.
+func (t *Tree) resolve() {
+	names := make([]string, 0, len(t.treeSet))
+	for name := range t.treeSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		Walk(t.treeSet[name].Root, func(n Node) bool {
+			if l, ok := n.(*NamedListNode); ok {
+				t.expand(l, make(map[string]bool))
+			}
+			return true
+		})
+	}
+}
+
+// expand replaces the references to list definitions in l. A reference with a
+// value gives that value to all the synonyms it stands for. Seen holds the
+// definitions being expanded, which cannot be referenced again.
+func (t *Tree) expand(l *NamedListNode, seen map[string]bool) {
+	var words, values []string
+	for i, w := range l.Words {
+		if w[0] != listRef {
+			words = append(words, w)
+			values = append(values, l.Values[i])
+			continue
+		}
+		name := string(listRef) + normalizeName(w[1:])
+		def, ok := t.treeSet[name]
+		if !ok || !IsListDefinition(def) {
+			t.nodeErrorf(l, "undefined list %q", name)
+		}
+		if seen[name] {
+			t.nodeErrorf(l, "list %q is defined in terms of itself", name)
+		}
+		ref := def.Root.Nodes[0].(*NamedListNode)
+		seen[name] = true
+		t.expand(ref, seen)
+		delete(seen, name)
+		for j, word := range ref.Words {
+			value := ref.Values[j]
+			if l.Values[i] != "" {
+				value = l.Values[i]
+			}
+			words = append(words, word)
+			values = append(values, value)
+		}
+	}
+	l.Words, l.Values = words, values
+}
+
+// IsListDefinition reports whether the tree holds a list definition rather
+// than a command. The name of a list definition starts with @.
+func IsListDefinition(t *Tree) bool {
+	return t.Name != "" && t.Name[0] == listRef
+}
+
+// normalizeName trims the spaces around the name of a command, list or
+// parameter and replaces the inner ones with underscores.
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(name), "_")
+}
+
+// block parses a single block of a command body.
+//
+//	word
+//	*
+//	?word or ?(...)
+//	#(...)
+//	(...)
+//	[...]
+//	{...}
+func (t *Tree) block() Node {
+	switch token := t.nextNonSpace(); token.typ {
+	case itemWord:
+		return t.newText(token.pos, token.val)
+	case itemIgnore:
+		return t.newIgnore(token.pos)
+	case itemOptional:
+		return t.optional(token)
+	case itemShuffle:
+		t.expect(itemLeftParen, "shuffle")
+		return t.newShuffle(token.pos, t.paren("shuffle"))
+	case itemLeftParen:
+		return t.newParen(token.pos, t.paren("parenthesized block"))
+	case itemLeftList:
+		return t.list(token)
+	case itemLeftParam:
+		return t.param(token)
+	default:
+		t.unexpected(token, "command")
+	}
+	return nil
+}
+
+// optional parses the block following a ? operator.
+//
+//	?word
+//	?(...)
+//
+// The ? has been scanned.
+func (t *Tree) optional(opt item) Node {
+	switch token := t.nextNonSpace(); token.typ {
+	case itemWord:
+		return t.newOptional(opt.pos, t.newText(token.pos, token.val))
+	case itemLeftParen:
+		return t.newOptional(opt.pos, t.newParen(token.pos, t.paren("optional")))
+	default:
+		t.unexpected(token, "optional")
+	}
+	return nil
+}
+
+// paren parses the blocks up to the matching right paren.
+// The left paren has been scanned.
+func (t *Tree) paren(context string) *ListNode {
+	list := t.newList(t.peekNonSpace().pos)
+	for {
+		switch token := t.peekNonSpace(); token.typ {
+		case itemRightParen:
+			t.nextNonSpace()
+			if len(list.Nodes) == 0 {
+				t.errorf("empty %s", context)
+			}
+			return list
+		case itemEOF:
+			t.errorf("unexpected EOF in %s: unmatched left paren", context)
+		}
+		list.append(t.block())
+	}
+}
+
+// list parses a list of synonyms.
+//
+//	[word,word]
+//	[name:word,word]
+//	[name:word=value,word]
+//	[name:word|word=value,word]
+//	[name:@name,word]
+//
+// The left bracket has been scanned.
+func (t *Tree) list(left item) *NamedListNode {
+	list := t.newNamedList(left.pos, "")
+	token := t.nextNonSpace()
+	if token.typ == itemListName {
+		list.Name = normalizeName(token.val)
+		if list.Name == "" {
+			t.errorf("missing list name")
+		}
+		if strings.ContainsRune(list.Name, listRef) {
+			t.errorf("unexpected %q in list name %q", listRef, list.Name)
+		}
+		t.expect(itemColon, "list")
+		token = t.nextNonSpace()
+	}
+	for {
+		switch token.typ {
+		case itemWord:
+			words := []string{t.listWord(token)}
+			for t.peekNonSpace().typ == itemPipe {
+				t.nextNonSpace()
+				words = append(words, t.listWord(t.expect(itemWord, "list")))
+			}
+			value := ""
+			if len(words) > 1 {
+				for _, word := range words {
+					if word[0] == listRef {
+						t.errorf("list reference %q cannot have synonyms", word)
+					}
+				}
+				// Synonyms without a value have the value of the first one.
+				value = words[0]
+			}
+			if t.peekNonSpace().typ == itemEquals {
+				t.nextNonSpace()
+				value = strings.Join(strings.Fields(t.expect(itemWord, "list").val), " ")
+				if value == "" {
+					t.errorf("empty value for %q in list", words[0])
+				}
+			}
+			for _, word := range words {
+				list.Words = append(list.Words, word)
+				list.Values = append(list.Values, value)
+			}
+		case itemComma:
+			// Only emitted after the first word, nothing to do.
+		case itemRightList:
+			return list
+		default:
+			t.unexpected(token, "list")
+		}
+		token = t.nextNonSpace()
+	}
+}
+
+// listWord returns the synonym held by token, with its whitespace collapsed.
+func (t *Tree) listWord(token item) string {
+	word := strings.Join(strings.Fields(token.val), " ")
+	if word == "" {
+		t.errorf("empty word in list")
+	}
+	if strings.IndexRune(word, listRef) > 0 {
+		t.errorf("unexpected %q in list word %q", listRef, word)
+	}
+	return word
+}
+
+// param parses a parameter.
+//
+//	{name}
+//	{name:type}
+//	{name=default}
+//	{name:type=default}
+//
+// The left brace has been scanned.
+func (t *Tree) param(left item) *ParamNode {
+	token := t.expect(itemParamName, "parameter")
+	param := t.newParam(left.pos, normalizeName(token.val), "")
+	if param.Name == "" {
+		t.errorf("missing parameter name")
+	}
+	token = t.nextNonSpace()
+	if token.typ == itemColon {
+		typ := t.expect(itemParamType, "parameter")
+		param.Typ = strings.TrimSpace(typ.val)
+		token = t.nextNonSpace()
+	}
+	if token.typ == itemEquals {
+		value := t.expect(itemParamValue, "parameter")
+		param.Default = strings.Join(strings.Fields(value.val), " ")
+		if param.Default == "" {
+			t.errorf("empty default value for parameter %q", param.Name)
+		}
+		token = t.nextNonSpace()
+	}
+	if token.typ != itemRightParam {
+		t.unexpected(token, "parameter")
+	}
+	return param
+}
+
+// check enforces the static semantic rules of the language, which parsing
+// alone does not guarantee:
+//
+//	two parameters cannot appear in sequence
+//	a parameter cannot be the first block of a command
+//	a command cannot be constituted only of parameters
+//
+// Commands breaking them would be ambiguous. Since optional blocks can be
+// absent, the blocks around them count as in sequence, a block preceded only
+// by optional ones counts as the first one, and words in optional blocks do
+// not count.
+func (t *Tree) check() {
+	for _, n := range t.Root.Nodes {
+		if startsWithParam(n) {
+			t.nodeErrorf(n, "command %q cannot start with a parameter", t.Name)
+		}
+		if !canBeAbsent(n) {
+			break
+		}
+	}
+	Walk(t.Root, func(n Node) bool {
+		switch n := n.(type) {
+		case *ListNode:
+			t.checkSequence(n.Nodes)
+		case *ParenNode:
+			t.checkSequence(n.List.Nodes)
+		case *ShuffleNode:
+			// Any block can follow any other one.
+			var param Node
+			for _, elem := range n.List.Nodes {
+				if !startsWithParam(elem) && !endsWithParam(elem) {
 					continue
 				}
-				t.backup2(delim)
+				if param != nil {
+					t.nodeErrorf(elem, "parameters in sequence in shuffled block")
+				}
+				param = elem
 			}
-			switch n := t.textOrAction(); n.Type() {
-			case nodeEnd, nodeElse:
-				t.errorf("unexpected %s", n)
-			default:
-				t.Root.append(n)
+		}
+		return true
+	})
+	if !hasWords(t.Root) {
+		t.nodeErrorf(t.Root, "command %q has no words", t.Name)
+	}
+}
+
+// checkSequence makes sure no two consecutive blocks have parameters next to
+// each other, also when the blocks between them are absent.
+func (t *Tree) checkSequence(nodes []Node) {
+	for i := 1; i < len(nodes); i++ {
+		if !startsWithParam(nodes[i]) {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if endsWithParam(nodes[j]) {
+				t.nodeErrorf(nodes[i], "parameters in sequence")
+			}
+			if !canBeAbsent(nodes[j]) {
+				break
+			}
+		}
+	}
+}
+
+// startsWithParam reports whether the text matching n can start with the value
+// of a parameter.
+func startsWithParam(n Node) bool {
+	switch n := n.(type) {
+	case *ParamNode:
+		return true
+	case *OptionalNode:
+		return startsWithParam(n.Node)
+	case *ParenNode:
+		for _, elem := range n.List.Nodes {
+			if startsWithParam(elem) {
+				return true
+			}
+			if !canBeAbsent(elem) {
+				break
+			}
+		}
+	case *ShuffleNode:
+		for _, elem := range n.List.Nodes {
+			if startsWithParam(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endsWithParam reports whether the text matching n can end with the value of
+// a parameter.
+func endsWithParam(n Node) bool {
+	switch n := n.(type) {
+	case *ParamNode:
+		return true
+	case *OptionalNode:
+		return endsWithParam(n.Node)
+	case *ParenNode:
+		for i := len(n.List.Nodes) - 1; i >= 0; i-- {
+			if endsWithParam(n.List.Nodes[i]) {
+				return true
+			}
+			if !canBeAbsent(n.List.Nodes[i]) {
+				break
 			}
-		*/
+		}
+	case *ShuffleNode:
+		for _, elem := range n.List.Nodes {
+			if endsWithParam(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// canBeAbsent reports whether n can match no words because it is optional or
+// made only of optional blocks.
+func canBeAbsent(n Node) bool {
+	var nodes []Node
+	switch n := n.(type) {
+	case *OptionalNode:
+		return true
+	case *ParenNode:
+		nodes = n.List.Nodes
+	case *ShuffleNode:
+		nodes = n.List.Nodes
+	default:
+		return false
+	}
+	for _, elem := range nodes {
+		if !canBeAbsent(elem) {
+			return false
+		}
 	}
+	return true
+}
 
+// hasWords reports whether the text matching n always holds words of the
+// command or of its lists.
+func hasWords(n Node) bool {
+	var nodes []Node
+	switch n := n.(type) {
+	case *TextNode, *NamedListNode:
+		return true
+	case *ListNode:
+		nodes = n.Nodes
+	case *ParenNode:
+		nodes = n.List.Nodes
+	case *ShuffleNode:
+		nodes = n.List.Nodes
+	default:
+		return false
+	}
+	for _, elem := range nodes {
+		if hasWords(elem) {
+			return true
+		}
+	}
+	return false
 }
 
 /*Parsing schema
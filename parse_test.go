@@ -0,0 +1,244 @@
+package vikyscript
+
+import (
+	"strings"
+	"testing"
+)
+
+var parseTests = []struct {
+	name, input, command, output string
+}{
+	{"word", "command:trial", "command", "trial"},
+	{"words", "command : foo  bar", "command", "foo bar"},
+	{"list", "command:[foo,bar]", "command", "[foo,bar]"},
+	{"namedlist", "command:[which:foo,bar]", "command", "[which:foo,bar]"},
+	{"listspace", "command:[foo foo,bar , lol]", "command", "[foo foo,bar,lol]"},
+	{"singleton", "command:[foo]", "command", "[foo]"},
+	{"namedlistspace", "command:[which one : foo,bar]", "command", "[which_one:foo,bar]"},
+	{"alias", "command:[lower=decrease,decrease]", "command", "[lower=decrease,decrease]"},
+	{"aliasspace", "command:[what: lower = decrease ,go  up=increase]", "command", "[what:lower=decrease,go up=increase]"},
+	{"synonyms", "command:[op:add|sum|put together=add, remove | delete=remove]", "command",
+		"[op:add|sum|put together=add,remove|delete=remove]"},
+	{"synonymsnovalue", "command:[add|sum,remove]", "command", "[add|sum=add,remove]"},
+	{"definition", "@colors = [red, green]\ncommand: paint [color:@colors, black]", "command",
+		"paint [color:red,green,black]"},
+	{"definitionvalue", "@colors = [red, dark blue=blue]\ncommand: paint [thing:@colors=color, black]", "command",
+		"paint [thing:red|dark blue=color,black]"},
+	{"definitionlater", "command: paint [@colors]\n@colors = [red, green]", "command", "paint [red,green]"},
+	{"definitionnested", "@warm = [red, orange]\n@colors = [@warm, blue]\ncommand: paint [@colors]", "command",
+		"paint [red,orange,blue]"},
+	{"definitiontree", "@ my colors = [red,blue]\ncommand: paint [@my colors]", "@my_colors", "[red,blue]"},
+	{"commandspace", " my  command :foo", "my_command", "foo"},
+	{"param", "command:foo {bar}", "command", "foo {bar}"},
+	{"typedparam", "command:foo { bar : integer }", "command", "foo {bar:integer}"},
+	{"paramdefault", "command:foo {bar = baz  qux }", "command", "foo {bar=baz qux}"},
+	{"typedparamdefault", "command:foo ?(of { bar : integer=10})", "command", "foo ?(of {bar:integer=10})"},
+	{"paramspace", "command:foo { bar baz  qux :integer }", "command", "foo {bar_baz_qux:integer}"},
+	{"unary", "command: * ?(foo) bar #(foo bar) * ?foo", "command", "* ?(foo) bar #(foo bar) * ?foo"},
+	{"nested", "command: baz * ?(foo #(bar bar)) ", "command", "baz * ?(foo #(bar bar))"},
+	{"volume", "volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer} ?percent))",
+		"volumeHandler", "#([what:increase,decrease,lower] * volume ?(* {percentage:integer} ?percent))"},
+	{"shopping", "shoppingList: [action:add,remove,delete] {what} [to,from] {when:date} * shopping list",
+		"shoppingList", "[action:add,remove,delete] {what} [to,from] {when:date} * shopping list"},
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range parseTests {
+		treeSet, err := Parse(tt.name, tt.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		tree, ok := treeSet[tt.command]
+		if !ok {
+			t.Errorf("%s: command %q not found", tt.name, tt.command)
+			continue
+		}
+		if got := tree.Root.String(); got != tt.output {
+			t.Errorf("%s: got\n\t%q\nexpected\n\t%q", tt.name, got, tt.output)
+		}
+	}
+}
+
+var parseErrorTests = []struct {
+	name, input string
+}{
+	{"unmatched", "command:("},
+	{"unexpected", "command:)"},
+	{"noname", ":foo"},
+	{"empty", "command:"},
+	{"emptyparen", "command:foo ()"},
+	{"emptylist", "command:[]"},
+	{"emptyword", "command:[foo,,bar]"},
+	{"unendedlist", "command:[foo,"},
+	{"unendedparam", "command:{bar:"},
+	{"emptyvalue", "command:[foo=,bar]"},
+	{"emptyalias", "command:[=foo]"},
+	{"doublealias", "command:[foo=bar=baz]"},
+	{"emptysynonym", "command:[foo|,bar]"},
+	{"firstemptysynonym", "command:[|foo]"},
+	{"synonymvalue", "command:[foo=bar|baz]"},
+	{"undefinedlist", "command: paint [@colors]"},
+	{"selfreference", "@colors = [red, @colors]"},
+	{"cyclicreference", "@a = [x, @b]\n@b = [@a]\ncommand: foo [@a]"},
+	{"nameddefinition", "@colors = [color: red]"},
+	{"nodefinitionname", "@ = [red]"},
+	{"definitiontrailing", "@colors = [red] foo"},
+	{"referencesynonyms", "@colors = [red]\ncommand: paint [@colors|blue]"},
+	{"referenceinword", "command: paint [red@colors]"},
+	{"referencename", "command: paint [@color:red]"},
+	{"duplicatedefinition", "@colors = [red]\n@colors = [blue]"},
+	{"noparamname", "command:foo {:integer}"},
+	{"emptydefault", "command:foo {bar= }"},
+	{"emptytypeddefault", "command:foo {bar:integer=}"},
+	{"shufflenoparen", "command:#foo"},
+	{"optionalignore", "command:?*"},
+}
+
+var checkErrorTests = []struct {
+	name, input, location string
+}{
+	{"sequence", "command:foo {bar} {baz}", "sequence:1:18"},
+	{"sequenceoptional", "command:foo {bar} ?({baz} qux)", "sequenceoptional:1:18"},
+	{"sequenceparen", "command:foo ({bar}) ({baz})", "sequenceparen:1:20"},
+	{"sequenceshuffle", "command:foo #({bar} qux {baz})", "sequenceshuffle:1:24"},
+	{"first", "command:{bar} foo", "first:1:8"},
+	{"firstoptional", "command: ?({bar} foo) foo", "firstoptional:1:9"},
+	{"onlyparams", "command:* {bar}", "onlyparams:1:8"},
+	{"sequenceafteroptional", "command:foo {a} ?bar {b}", "sequenceafteroptional:1:21"},
+	{"sequenceparenoptional", "command:foo ({a} ?bar) {b}", "sequenceparenoptional:1:23"},
+	{"firstafteroptional", "command: ?hello {x}", "firstafteroptional:1:16"},
+	{"onlyoptionalwords", "command: ?foo * ?(bar baz)", "onlyoptionalwords:1:9"},
+}
+
+func TestParseError(t *testing.T) {
+	for _, tt := range parseErrorTests {
+		if _, err := Parse(tt.name, tt.input); err == nil {
+			t.Errorf("%s: expected error while parsing <%s>", tt.name, tt.input)
+		} else {
+			t.Log(err)
+		}
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	for _, tt := range checkErrorTests {
+		_, err := Parse(tt.name, tt.input)
+		if err == nil {
+			t.Errorf("%s: expected error while parsing <%s>", tt.name, tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.location+":") {
+			t.Errorf("%s: expected error at %s, got %v", tt.name, tt.location, err)
+		}
+	}
+}
+
+const script = `// Volume changing
+volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer} ?percent))
+
+# Shopping list
+shoppingList: [action:add,remove,delete] {what} [to,from] {when:date} * shopping list
+  greet : hello ?there
+`
+
+func TestParseScript(t *testing.T) {
+	treeSet, err := Parse("script", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]string{
+		"volumeHandler": "#([what:increase,decrease,lower] * volume ?(* {percentage:integer} ?percent))",
+		"shoppingList":  "[action:add,remove,delete] {what} [to,from] {when:date} * shopping list",
+		"greet":         "hello ?there",
+	}
+	if len(treeSet) != len(exp) {
+		t.Errorf("got %d commands expected %d", len(treeSet), len(exp))
+	}
+	for name, body := range exp {
+		tree, ok := treeSet[name]
+		if !ok {
+			t.Errorf("command %q not found", name)
+			continue
+		}
+		if got := tree.Root.String(); got != body {
+			t.Errorf("%s: got\n\t%q\nexpected\n\t%q", name, got, body)
+		}
+	}
+	// Errors must be reported at the right line.
+	loc, _ := treeSet["greet"].ErrorContext(treeSet["greet"].Root.Nodes[1])
+	if loc != "script:6:16" {
+		t.Errorf("got location %s expected script:6:16", loc)
+	}
+}
+
+func TestParseDuplicate(t *testing.T) {
+	_, err := Parse("duplicate", "greet: hello\nother: foo\ngreet: hi")
+	if err == nil || !strings.Contains(err.Error(), "multiple definition") {
+		t.Errorf("expected multiple definition error, got %v", err)
+	}
+}
+
+func TestParseErrorLine(t *testing.T) {
+	_, err := Parse("lines", "first: foo\n\nsecond: foo )\nthird: baz")
+	if err == nil || !strings.Contains(err.Error(), "lines:3:") {
+		t.Errorf("expected error at line 3, got %v", err)
+	}
+	_, err = Parse("lines", "first: foo\n\n : bar")
+	if err == nil || !strings.Contains(err.Error(), "lines:3:") {
+		t.Errorf("expected error at line 3, got %v", err)
+	}
+}
+
+func TestParseOverride(t *testing.T) {
+	treeSet := make(map[string]*Tree)
+	tree := New("override")
+	tree.Mode = OverrideDefinitions
+	if _, err := tree.Parse("greet: hello\nother: foo\ngreet: hi", treeSet); err != nil {
+		t.Fatal(err)
+	}
+	if got := treeSet["greet"].Root.String(); got != "hi" {
+		t.Errorf("got %q expected the last definition", got)
+	}
+	// Later scripts can override commands of previous ones as well.
+	if _, err := tree.Parse("other: bar", treeSet); err != nil {
+		t.Fatal(err)
+	}
+	if got := treeSet["other"].Root.String(); got != "bar" {
+		t.Errorf("got %q expected the last definition", got)
+	}
+	tree.Mode = 0
+	if _, err := tree.Parse("other: baz", treeSet); err == nil {
+		t.Errorf("expected multiple definition error")
+	}
+}
+
+func TestIsEmptyTree(t *testing.T) {
+	tr := New("empty")
+	list := func(nodes ...Node) *ListNode {
+		l := tr.newList(0)
+		l.Nodes = nodes
+		return l
+	}
+	var nilList *ListNode
+	tests := []struct {
+		node  Node
+		empty bool
+	}{
+		{nil, true},
+		{nilList, true},
+		{list(), true},
+		{list(tr.newText(0, " ")), true},
+		{list(tr.newText(0, "foo")), false},
+		{tr.newNamedList(0, "name"), true},
+		{tr.newOptional(0, tr.newParen(0, list(tr.newText(0, "")))), true},
+		{tr.newShuffle(0, list(tr.newParen(0, list()), tr.newOptional(0, tr.newText(0, "\t")))), true},
+		{tr.newShuffle(0, list(tr.newParen(0, list()), tr.newIgnore(0))), false},
+		{list(tr.newParam(0, "foo", "")), false},
+	}
+	for _, tt := range tests {
+		if got := IsEmptyTree(tt.node); got != tt.empty {
+			t.Errorf("IsEmptyTree(%v): got %v expected %v", tt.node, got, tt.empty)
+		}
+	}
+}
@@ -1,16 +1,85 @@
 package vikyscript
 
-import "regexp"
+import (
+	"errors"
+	"sort"
+)
 
+// ErrNoMatch is returned when no command matches a sentence.
+var ErrNoMatch = errors.New("no match")
+
+// Param is a parameter extracted from a matched sentence.
+type Param struct {
+	Name  string
+	Value string // Empty if the parameter is part of a block that was not present.
+}
+
+// Result is the outcome of a successful match.
+type Result struct {
+	Command    string  // The name of the matched command.
+	Params     []Param // The parameters, in order of appearance in the command.
+	TypeErrors []int   // The indexes in Params of the parameters whose type conversion failed.
+	Literal    int     // The number of words matched by the words and lists of the command.
+	Ignored    int     // The number of words matched by * operators.
+	// Score is the confidence of the match, between 0 and 1: the ratio of the
+	// words matched by the words and lists of the command over all the words
+	// of the sentence, the rest being ignored or part of parameters.
+	Score float64
+}
+
+// Recognizer matches sentences against the commands defined in a script.
+// Once compiled, the commands are held by the embedded Registry, which more
+// commands can be added to.
 type Recognizer struct {
+	*Registry
+	// Mode is the mode used to parse the source. Set OverrideDefinitions to
+	// let the commands replace the ones with the same name already in the
+	// registry, and later commands replace earlier ones.
+	Mode Mode
+	// Tolerance is the largest number of letters that can be misspelled in a
+	// word of the sentence for it to match a word of a command or of a list.
+	// Words that match only because of the tolerance count half in the score.
+	// It is read by Compile.
+	Tolerance int
+	// Phonetic makes the words of the sentence that sound like a word of a
+	// list match it, as homophones are a common mistake of speech
+	// recognition. The value of a named list is still the word of the list.
+	// Words that match only because of their sound count half in the score.
+	// It is read by Compile.
+	Phonetic bool
+
 	source string
-	re     regexp.Regexp
 }
 
 func NewRecognizer(source string) *Recognizer {
-	return &Recognizer{source: source}
+	return &Recognizer{Registry: new(Registry), source: source}
 }
-func (r *Recognizer) Compile() {}
-func (r *Recognizer) Match(what string) []string {
-	return []string{""}
+
+// Compile parses the source of the recognizer, translates every command into
+// a regular expression and adds them to the registry, in alphabetical order.
+// It must be called before Match. Unless definitions can be overridden, it
+// adds no command if one with the same name is already registered.
+func (r *Recognizer) Compile() error {
+	treeSet := make(map[string]*Tree)
+	t := New("recognizer")
+	t.Mode = r.Mode
+	if _, err := t.Parse(r.source, treeSet); err != nil {
+		return err
+	}
+	var commands []Matcher
+	for _, tree := range treeSet {
+		if IsListDefinition(tree) {
+			continue
+		}
+		c, err := compile(tree)
+		if err != nil {
+			return err
+		}
+		c.tolerance, c.phonetic = r.Tolerance, r.Phonetic
+		commands = append(commands, c)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		return commands[i].Name() < commands[j].Name()
+	})
+	return r.addAll(commands, r.Mode&OverrideDefinitions != 0)
 }
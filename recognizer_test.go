@@ -0,0 +1,177 @@
+package vikyscript
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var matchTests = []struct {
+	source, text, command string
+	params                []Param
+	typeErrors            []int
+}{
+	{volumeCommand, "Increase volume", "volumeHandler",
+		[]Param{{"what", "increase"}, {"percentage", ""}}, nil},
+	{volumeCommand, "Increase the volume ten percent", "volumeHandler",
+		[]Param{{"what", "increase"}, {"percentage", "10"}}, nil},
+	{volumeCommand, "Lower the volume of one hundred", "volumeHandler",
+		[]Param{{"what", "lower"}, {"percentage", "100"}}, nil},
+	{volumeCommand, "Lower the volume of twenty-five percent", "volumeHandler",
+		[]Param{{"what", "lower"}, {"percentage", "25"}}, nil},
+	{"setVolume: set volume to {level:integer} percent", "Set volume to a lot percent", "setVolume",
+		[]Param{{"level", "a lot"}}, []int{0}},
+	{"setVolume: set volume to {level:integer} percent", "Set volume to a hundred percent", "setVolume",
+		[]Param{{"level", "100"}}, nil},
+	{volumeCommand, "Volume increase twenty", "volumeHandler",
+		[]Param{{"what", "increase"}, {"percentage", "20"}}, nil},
+	{"command: go #(a b c {x} d [y:e,f] g) h", "go g f b a c d something h", "command",
+		[]Param{{"x", "something"}, {"y", "f"}}, nil},
+	{"command: go #(a b c d e [l:a,z])", "go a a b c d e", "command",
+		[]Param{{"l", "a"}}, nil},
+	{"command: go #(a b c d e {x}) now", "go e x y d c b a now", "command",
+		[]Param{{"x", "x y"}}, nil},
+	{shoppingCommand, "Add potatoes to tomorrow's shopping list", "shoppingList",
+		[]Param{{"action", "add"}, {"what", "potatoes"}, {"when", "2017-05-11T00:00:00Z"}}, nil},
+	{shoppingCommand, "Remove green apples from Wednesday's shopping list", "shoppingList",
+		[]Param{{"action", "remove"}, {"what", "green apples"}, {"when", "2017-05-10T00:00:00Z"}}, nil},
+	{shoppingCommand, "Add milk to someday's shopping list", "shoppingList",
+		[]Param{{"action", "add"}, {"what", "milk"}, {"when", "someday's"}}, []int{2}},
+	{"command: [action:add] {what} for {amount:integer} on {when:date}", "add milk for lots on someday", "command",
+		[]Param{{"action", "add"}, {"what", "milk"}, {"amount", "lots"}, {"when", "someday"}}, []int{2, 3}},
+	{"command: foo [bar,baz]", "foo baz", "command", nil, nil},
+	{"my command: [which one : foo,bar] is {the thing}", "bar is good", "my_command",
+		[]Param{{"which_one", "bar"}, {"the_thing", "good"}}, nil},
+	{"command: [what:increase,lower=decrease,decrease] the volume", "Lower the volume", "command",
+		[]Param{{"what", "decrease"}}, nil},
+	{"command: [what:add, put  together ,Sum] {this} and {that}", "Put together one and two", "command",
+		[]Param{{"what", "put_together"}, {"this", "one"}, {"that", "two"}}, nil},
+	{"command: [what:add, put  together ,Sum] {this} and {that}", "sum one and two", "command",
+		[]Param{{"what", "Sum"}, {"this", "one"}, {"that", "two"}}, nil},
+	{"command: [what:lower=decrease,lower,low] it", "lower it", "command",
+		[]Param{{"what", "decrease"}}, nil},
+	{"command: [op:add|sum|put together=add, remove|delete=remove] {this} and {that}", "put together one and two", "command",
+		[]Param{{"op", "add"}, {"this", "one"}, {"that", "two"}}, nil},
+	{"command: [op:add|sum|put together=add, remove|delete=remove] {this} and {that}", "delete one and two", "command",
+		[]Param{{"op", "remove"}, {"this", "one"}, {"that", "two"}}, nil},
+	{"command: [op:plus|sum,minus] {this} and {that}", "sum one and two", "command",
+		[]Param{{"op", "plus"}, {"this", "one"}, {"that", "two"}}, nil},
+	{"volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer=10} ?percent))",
+		"Increase the volume", "volumeHandler", []Param{{"what", "increase"}, {"percentage", "10"}}, nil},
+	{"volumeHandler: #([what:increase,decrease,lower] * volume ?( * {percentage:integer=10} ?percent))",
+		"Increase the volume of five percent", "volumeHandler", []Param{{"what", "increase"}, {"percentage", "5"}}, nil},
+	{"command: remind me to {what} ?(on {when:date=tomorrow})", "remind me to call mom", "command",
+		[]Param{{"what", "call mom"}, {"when", "2017-05-11T00:00:00Z"}}, nil},
+	{"command: call ?(at {number:integer = one hundred}) now", "call now", "command",
+		[]Param{{"number", "100"}}, nil},
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range matchTests {
+		r := NewRecognizer(tt.source)
+		r.Clock = func() time.Time { return dateNow }
+		if err := r.Compile(); err != nil {
+			t.Errorf("unexpected error compiling %q: %v", tt.source, err)
+			continue
+		}
+		res, err := r.Match(tt.text)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.text, err)
+			continue
+		}
+		if res.Command != tt.command {
+			t.Errorf("%q: got command %q expected %q", tt.text, res.Command, tt.command)
+		}
+		if got, exp := fmt.Sprint(res.Params), fmt.Sprint(tt.params); got != exp {
+			t.Errorf("%q: got params %s expected %s", tt.text, got, exp)
+		}
+		if got, exp := fmt.Sprint(res.TypeErrors), fmt.Sprint(tt.typeErrors); got != exp {
+			t.Errorf("%q: got type errors %s expected %s", tt.text, got, exp)
+		}
+	}
+}
+
+func TestNoMatch(t *testing.T) {
+	r := NewRecognizer(shoppingCommand)
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Match("potatoes remove from Wednesday's shopping list"); err != ErrNoMatch {
+		t.Errorf("got error %v expected %v", err, ErrNoMatch)
+	}
+}
+
+func TestDuplicateParam(t *testing.T) {
+	r := NewRecognizer("command: [what:foo,bar] {what}")
+	if err := r.Compile(); err == nil {
+		t.Errorf("expected error for duplicate parameter")
+	}
+}
+
+func TestInvalidDefault(t *testing.T) {
+	r := NewRecognizer("command: foo ?(of {amount:integer=lots})")
+	if err := r.Compile(); err == nil || !strings.Contains(err.Error(), "invalid default value") {
+		t.Errorf("got error %v expected an invalid default value", err)
+	}
+}
+
+func TestUnknownType(t *testing.T) {
+	r := NewRecognizer("command: foo {what:potato}")
+	if err := r.Compile(); err == nil {
+		t.Errorf("expected error for unknown type")
+	}
+}
+
+const listScript = `
+@colors = [red, green, dark blue=blue]
+@rooms = [kitchen, living room, bedroom]
+
+paint: paint the [room:@rooms] [color:@colors]
+lights: turn on the lights in the [room:@rooms]
+`
+
+func TestMatchListDefinitions(t *testing.T) {
+	r := NewRecognizer(listScript)
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(r.List()); got != 2 {
+		t.Errorf("got %d commands expected 2", got)
+	}
+	for text, params := range map[string][]Param{
+		"Paint the bedroom dark blue":           {{"room", "bedroom"}, {"color", "blue"}},
+		"Turn on the lights in the living room": {{"room", "living_room"}},
+	} {
+		res, err := r.Match(text)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", text, err)
+			continue
+		}
+		if got, exp := fmt.Sprint(res.Params), fmt.Sprint(params); got != exp {
+			t.Errorf("%q: got params %s expected %s", text, got, exp)
+		}
+	}
+}
+
+func TestMatchScript(t *testing.T) {
+	r := NewRecognizer(script)
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	for text, command := range map[string]string{
+		"Hello there":                             "greet",
+		"Add milk to tomorrow's shopping list":    "shoppingList",
+		"Increase the volume of twenty percent":   "volumeHandler",
+		"Delete eggs from Friday's shopping list": "shoppingList",
+	} {
+		res, err := r.Match(text)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", text, err)
+			continue
+		}
+		if res.Command != command {
+			t.Errorf("%q: got command %q expected %q", text, res.Command, command)
+		}
+	}
+}
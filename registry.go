@@ -0,0 +1,315 @@
+package vikyscript
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Matcher matches sentences against a single command.
+type Matcher interface {
+	// Name returns the name of the command.
+	Name() string
+	// Match matches text against the command. Relative values of parameters
+	// are resolved with respect to now. It returns nil if text does not match.
+	Match(text string, now time.Time) *Result
+}
+
+// ClashError is returned when more than one command matches a sentence, and
+// the ClashPolicy of the registry cannot choose among them.
+type ClashError struct {
+	Commands []string  // The names of the clashing commands.
+	Results  []*Result // All the matches, ranked as by MatchAll.
+}
+
+// ClashPolicy decides which match is returned when more than one command
+// matches a sentence.
+type ClashPolicy int
+
+const (
+	// ClashFail returns a *ClashError.
+	ClashFail ClashPolicy = iota
+	// ClashPriority returns the match of the command with the highest
+	// priority.
+	ClashPriority
+	// ClashMostSpecific returns the match with the most words matched by
+	// words and lists, then the one with fewest words ignored by *.
+	ClashMostSpecific
+	// ClashBestScore returns the match with the highest score.
+	ClashBestScore
+)
+
+func (ce *ClashError) Error() string {
+	return fmt.Sprintf("Clash of commands: %s", strings.Join(ce.Commands, ", "))
+}
+
+// Registry is a set of commands sentences are matched against. The zero value
+// is an empty registry ready to use. It is safe for concurrent use.
+type Registry struct {
+	// Clock returns the reference time used to resolve relative values of
+	// parameters, such as "tomorrow". If nil, time.Now is used.
+	Clock func() time.Time
+	// Policy decides the command Match returns when more than one matches. If
+	// the policy cannot decide, a *ClashError is returned.
+	Policy ClashPolicy
+	// MinScore is the minimum score of a match. Matches with a lower score
+	// are discarded.
+	MinScore float64
+
+	mu         sync.RWMutex
+	matchers   []Matcher // In order of addition.
+	priorities map[string]int
+	handlers   map[string]handler
+}
+
+// Add adds m to the registry. It fails if a command with the same name is
+// already present.
+func (r *Registry) Add(m Matcher) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index(m.Name()) >= 0 {
+		return fmt.Errorf("command %q already registered", m.Name())
+	}
+	r.matchers = append(r.matchers, m)
+	return nil
+}
+
+// Remove removes the command with the given name from the registry, together
+// with its priority and the function bound to it, and reports whether it was
+// present.
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(name)
+	if i < 0 {
+		return false
+	}
+	r.matchers = append(r.matchers[:i:i], r.matchers[i+1:]...)
+	delete(r.priorities, name)
+	delete(r.handlers, name)
+	return true
+}
+
+// Replace replaces the command with the same name of m, if present, or adds
+// m to the registry otherwise. The function bound to the command replaced
+// stays bound only if it can be passed the parameters of m.
+func (r *Registry) Replace(m Matcher) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := r.index(m.Name()); i >= 0 {
+		// MatchAll reads the slice it took without holding the lock.
+		matchers := make([]Matcher, len(r.matchers))
+		copy(matchers, r.matchers)
+		matchers[i] = m
+		r.matchers = matchers
+		r.rebind(m)
+		return
+	}
+	r.matchers = append(r.matchers, m)
+}
+
+// addAll adds ms to the registry in a single step, replacing the commands
+// with the same names as Replace does if replace is set. Otherwise, it fails
+// without adding any of them if a command with one of their names is already
+// present.
+func (r *Registry) addAll(ms []Matcher, replace bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !replace {
+		for _, m := range ms {
+			if r.index(m.Name()) >= 0 {
+				return fmt.Errorf("command %q already registered", m.Name())
+			}
+		}
+	}
+	matchers := append([]Matcher(nil), r.matchers...)
+	for _, m := range ms {
+		if i := r.index(m.Name()); i >= 0 {
+			matchers[i] = m
+			r.rebind(m)
+		} else {
+			matchers = append(matchers, m)
+		}
+	}
+	r.matchers = matchers
+	return nil
+}
+
+// SetPriority sets the priority of the command with the given name, used to
+// rank matches. Commands have priority 0 by default.
+func (r *Registry) SetPriority(name string, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.priorities == nil {
+		r.priorities = make(map[string]int)
+	}
+	r.priorities[name] = priority
+}
+
+// List returns the names of the commands in the registry, in order of
+// addition.
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, len(r.matchers))
+	for i, m := range r.matchers {
+		names[i] = m.Name()
+	}
+	return names
+}
+
+// Lookup returns the command with the given name, and reports whether it is in
+// the registry.
+func (r *Registry) Lookup(name string) (Matcher, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if i := r.index(name); i >= 0 {
+		return r.matchers[i], true
+	}
+	return nil, false
+}
+
+// index returns the index of the command with the given name, or -1.
+// r.mu must be held.
+func (r *Registry) index(name string) int {
+	for i, m := range r.matchers {
+		if m.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Match matches text against all the commands of the registry. It returns
+// ErrNoMatch if no command matches with a score of at least MinScore. If more
+// than one does, the match is chosen by the Policy of the registry, and a
+// *ClashError is returned if it cannot choose.
+func (r *Registry) Match(text string) (*Result, error) {
+	ranked := r.MatchAll(text)
+	if len(ranked) == 0 {
+		return nil, ErrNoMatch
+	}
+	if len(ranked) == 1 {
+		return ranked[0], nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	switch r.Policy {
+	case ClashPriority:
+		// Since matches are ranked by priority first, the first one is chosen
+		// if its priority is higher than the one of the second.
+		if r.priorities[ranked[0].Command] > r.priorities[ranked[1].Command] {
+			return ranked[0], nil
+		}
+	case ClashBestScore:
+		// Matches are ranked by priority first, so all of them are compared.
+		if m, ok := best(ranked, byScore); ok {
+			return m, nil
+		}
+	case ClashMostSpecific:
+		if m, ok := best(ranked, specificity); ok {
+			return m, nil
+		}
+	}
+	var names []string
+	for _, m := range ranked {
+		names = append(names, m.Command)
+	}
+	return nil, &ClashError{Commands: names, Results: ranked}
+}
+
+// MatchAll matches text against all the commands of the registry, and returns
+// all the matches whose score is at least MinScore ranked by the priority of
+// their commands, then by score, then by specificity, then by order of
+// addition of the commands.
+func (r *Registry) MatchAll(text string) []*Result {
+	now := time.Now()
+	if r.Clock != nil {
+		now = r.Clock()
+	}
+	r.mu.RLock()
+	matchers := r.matchers
+	r.mu.RUnlock()
+	pool := runtime.NumCPU()
+	tomatch := make(chan int)
+	results := make([]*Result, len(matchers))
+	var wg sync.WaitGroup
+	wg.Add(pool)
+	//spawn workers
+	for i := 0; i < pool; i++ {
+		go func() {
+			//Signal we finished processing data
+			defer wg.Done()
+			for i := range tomatch {
+				results[i] = matchers[i].Match(text, now)
+			}
+		}()
+	}
+	//Send the matchers to the workers
+	for i := range matchers {
+		tomatch <- i
+	}
+	close(tomatch)
+	//Let the matchers match
+	wg.Wait()
+	var matched []*Result
+	for _, res := range results {
+		if res != nil && res.Score >= r.MinScore {
+			matched = append(matched, res)
+		}
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if pa, pb := r.priorities[a.Command], r.priorities[b.Command]; pa != pb {
+			return pa > pb
+		}
+		if c := byScore(a, b); c != 0 {
+			return c < 0
+		}
+		return specificity(a, b) < 0
+	})
+	return matched
+}
+
+// best returns the best of the matches according to cmp, and reports whether
+// it is better than all the others.
+func best(matches []*Result, cmp func(a, b *Result) int) (*Result, bool) {
+	m, unique := matches[0], true
+	for _, other := range matches[1:] {
+		switch c := cmp(other, m); {
+		case c < 0:
+			m, unique = other, true
+		case c == 0:
+			unique = false
+		}
+	}
+	return m, unique
+}
+
+// byScore compares the score of two matches. It returns a negative number if
+// a has a higher score than b, a positive one if b has a higher score than a,
+// and zero if they have the same score.
+func byScore(a, b *Result) int {
+	switch {
+	case a.Score > b.Score:
+		return -1
+	case a.Score < b.Score:
+		return 1
+	}
+	return 0
+}
+
+// specificity compares the specificity of two matches. It returns a negative
+// number if a is more specific than b, a positive one if b is more specific
+// than a, and zero if they are equally specific.
+func specificity(a, b *Result) int {
+	if a.Literal != b.Literal {
+		return b.Literal - a.Literal
+	}
+	return a.Ignored - b.Ignored
+}
@@ -0,0 +1,240 @@
+package vikyscript
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// wordMatcher matches sentences containing a word.
+type wordMatcher string
+
+func (w wordMatcher) Name() string {
+	return string(w)
+}
+
+func (w wordMatcher) Match(text string, now time.Time) *Result {
+	if !strings.Contains(strings.ToLower(text), string(w)) {
+		return nil
+	}
+	return &Result{Command: string(w)}
+}
+
+func TestRegistry(t *testing.T) {
+	var r Registry
+	for _, m := range []Matcher{wordMatcher("foo"), wordMatcher("bar"), wordMatcher("baz")} {
+		if err := r.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Add(wordMatcher("bar")); err == nil {
+		t.Errorf("expected error adding a command twice")
+	}
+	if got := strings.Join(r.List(), ","); got != "foo,bar,baz" {
+		t.Errorf("got commands %s", got)
+	}
+	if !r.Remove("bar") || r.Remove("bar") {
+		t.Errorf("unexpected result removing a command")
+	}
+	r.Replace(wordMatcher("qux"))
+	if got := strings.Join(r.List(), ","); got != "foo,baz,qux" {
+		t.Errorf("got commands %s", got)
+	}
+	res, err := r.Match("Qux")
+	if err != nil || res.Command != "qux" {
+		t.Errorf("unexpected match %v: %v", res, err)
+	}
+	if _, err := r.Match("bar"); err != ErrNoMatch {
+		t.Errorf("got error %v expected %v", err, ErrNoMatch)
+	}
+	_, err = r.Match("foo qux baz")
+	ce, ok := err.(*ClashError)
+	if !ok {
+		t.Fatalf("got error %v expected a clash", err)
+	}
+	if got := strings.Join(ce.Commands, ","); got != "foo,baz,qux" {
+		t.Errorf("got clashing commands %s", got)
+	}
+}
+
+func TestConcurrentReplace(t *testing.T) {
+	var r Registry
+	for _, m := range []Matcher{wordMatcher("foo"), wordMatcher("bar")} {
+		if err := r.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Run with -race to check that matching does not read the commands being
+	// replaced.
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 1000; i++ {
+			r.Replace(wordMatcher("foo"))
+		}
+		close(done)
+	}()
+	for i := 0; i < 1000; i++ {
+		r.MatchAll("foo bar")
+	}
+	<-done
+}
+
+func TestRecognizerRegistry(t *testing.T) {
+	r := NewRecognizer("greet: hello ?there\nbye: goodbye")
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(r.List(), ","); got != "bye,greet" {
+		t.Errorf("got commands %s", got)
+	}
+	if err := r.Add(wordMatcher("thanks")); err != nil {
+		t.Fatal(err)
+	}
+	if res, err := r.Match("many thanks"); err != nil || res.Command != "thanks" {
+		t.Errorf("unexpected match %v: %v", res, err)
+	}
+	// Compiling again clashes with the compiled commands, unless they are
+	// overridden.
+	if err := r.Compile(); err == nil {
+		t.Errorf("expected error compiling twice")
+	}
+	r.Mode = OverrideDefinitions
+	if err := r.Compile(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRecognizerRegistryClash(t *testing.T) {
+	r := NewRecognizer("a: new\nb: y")
+	if err := r.Add(wordMatcher("b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Compile(); err == nil {
+		t.Errorf("expected error compiling a registered command")
+	}
+	if got := strings.Join(r.List(), ","); got != "b" {
+		t.Errorf("got commands %s expected none to be added", got)
+	}
+}
+
+const clashScript = `lights: turn on the lights
+turnOn: turn on {device}
+play: play * music
+playArtist: play {artist} music`
+
+var clashTests = []struct {
+	text     string
+	policy   ClashPolicy
+	command  string // Empty for a clash.
+	priority string // Command with a higher priority, if any.
+}{
+	{"turn on the lights", ClashFail, "", ""},
+	{"turn on the lights", ClashMostSpecific, "lights", ""},
+	{"turn on the lights", ClashPriority, "", ""},
+	{"turn on the lights", ClashPriority, "turnOn", "turnOn"},
+	{"turn on the lights", ClashMostSpecific, "lights", "turnOn"},
+	{"play some music", ClashMostSpecific, "playArtist", ""},
+	{"play music", ClashFail, "play", ""},
+	{"turn on the radio", ClashFail, "turnOn", ""},
+}
+
+func TestClash(t *testing.T) {
+	for _, tt := range clashTests {
+		r := NewRecognizer(clashScript)
+		if err := r.Compile(); err != nil {
+			t.Fatal(err)
+		}
+		r.Policy = tt.policy
+		if tt.priority != "" {
+			r.SetPriority(tt.priority, 1)
+		}
+		res, err := r.Match(tt.text)
+		if tt.command == "" {
+			ce, ok := err.(*ClashError)
+			if !ok {
+				t.Errorf("%q: got %v, %v expected a clash", tt.text, res, err)
+				continue
+			}
+			if len(ce.Results) != len(ce.Commands) || len(ce.Results) < 2 {
+				t.Errorf("%q: unexpected clash %v", tt.text, ce)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.text, err)
+			continue
+		}
+		if res.Command != tt.command {
+			t.Errorf("%q: got command %q expected %q", tt.text, res.Command, tt.command)
+		}
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	r := NewRecognizer(clashScript)
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, res := range r.MatchAll("turn on the lights") {
+		got = append(got, res.Command)
+	}
+	if strings.Join(got, ",") != "lights,turnOn" {
+		t.Errorf("got ranking %v", got)
+	}
+	r.SetPriority("turnOn", 1)
+	got = nil
+	for _, res := range r.MatchAll("turn on the lights") {
+		got = append(got, res.Command)
+	}
+	if strings.Join(got, ",") != "turnOn,lights" {
+		t.Errorf("got ranking %v", got)
+	}
+}
+
+var scoreTests = []struct {
+	text    string
+	command string
+	score   float64
+}{
+	{"turn on the lights", "lights", 1},
+	{"turn on the radio", "turnOn", 0.5},
+	{"turn on the kitchen lights", "turnOn", 0.4},
+	{"play music", "play", 1},
+	{"play some loud music", "play", 0.5},
+	{"play The Beatles music", "playArtist", 0.5},
+}
+
+func TestScore(t *testing.T) {
+	r := NewRecognizer(clashScript)
+	if err := r.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range scoreTests {
+		var score float64
+		found := false
+		for _, res := range r.MatchAll(tt.text) {
+			if res.Command == tt.command {
+				score, found = res.Score, true
+			}
+		}
+		if !found {
+			t.Errorf("%q: %s did not match", tt.text, tt.command)
+			continue
+		}
+		if score != tt.score {
+			t.Errorf("%q: got score %v expected %v", tt.text, score, tt.score)
+		}
+	}
+	r.Policy = ClashBestScore
+	if res, err := r.Match("turn on the lights"); err != nil || res.Command != "lights" {
+		t.Errorf("unexpected match %v: %v", res, err)
+	}
+	r.MinScore = 0.6
+	if _, err := r.Match("turn on the radio"); err != ErrNoMatch {
+		t.Errorf("got error %v expected %v", err, ErrNoMatch)
+	}
+	if res, err := r.Match("turn on the lights"); err != nil || res.Command != "lights" {
+		t.Errorf("unexpected match %v: %v", res, err)
+	}
+}
@@ -0,0 +1,357 @@
+package vikyscript
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// converters convert the values of parameters to the canonical form of their
+// type. The empty type is the one of named lists and untyped parameters.
+// Relative values are resolved with respect to now.
+var converters = map[string]func(s string, now time.Time) (string, error){
+	"":        convertString,
+	"string":  convertString,
+	"integer": convertInteger,
+	"date":    convertDate,
+}
+
+// typeExprs holds the regular expressions matching the values of the types
+// that have a recognizable form.
+var typeExprs = map[string]string{
+	"integer": numberExpr(),
+}
+
+// Convert converts value to the canonical form of the type typ, as it is
+// passed to handlers. Relative values are resolved with respect to now.
+// Supported types are "string", which is also the one of the empty type,
+// "integer" and "date".
+func Convert(typ, value string, now time.Time) (string, error) {
+	conv, ok := converters[typ]
+	if !ok {
+		return "", fmt.Errorf("unknown type %q", typ)
+	}
+	return conv(value, now)
+}
+
+// IsType reports whether typ is a supported type.
+func IsType(typ string) bool {
+	_, ok := converters[typ]
+	return ok
+}
+
+func convertString(s string, now time.Time) (string, error) {
+	return s, nil
+}
+
+func convertInteger(s string, now time.Time) (string, error) {
+	n, err := parseNumber(s)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(n), nil
+}
+
+// numberClass is the grammatical class of a word of a number.
+type numberClass int
+
+const (
+	numberNone numberClass = iota
+	numberDigits
+	numberUnit
+	numberTeen
+	numberTen
+	numberHundred
+	numberScale
+	numberAnd
+	numberArticle
+)
+
+type numberWord struct {
+	class numberClass
+	value int
+}
+
+var numberWords = map[string]numberWord{
+	"zero":      {numberUnit, 0},
+	"one":       {numberUnit, 1},
+	"two":       {numberUnit, 2},
+	"three":     {numberUnit, 3},
+	"four":      {numberUnit, 4},
+	"five":      {numberUnit, 5},
+	"six":       {numberUnit, 6},
+	"seven":     {numberUnit, 7},
+	"eight":     {numberUnit, 8},
+	"nine":      {numberUnit, 9},
+	"ten":       {numberTeen, 10},
+	"eleven":    {numberTeen, 11},
+	"twelve":    {numberTeen, 12},
+	"thirteen":  {numberTeen, 13},
+	"fourteen":  {numberTeen, 14},
+	"fifteen":   {numberTeen, 15},
+	"sixteen":   {numberTeen, 16},
+	"seventeen": {numberTeen, 17},
+	"eighteen":  {numberTeen, 18},
+	"nineteen":  {numberTeen, 19},
+	"twenty":    {numberTen, 20},
+	"thirty":    {numberTen, 30},
+	"forty":     {numberTen, 40},
+	"fifty":     {numberTen, 50},
+	"sixty":     {numberTen, 60},
+	"seventy":   {numberTen, 70},
+	"eighty":    {numberTen, 80},
+	"ninety":    {numberTen, 90},
+	"hundred":   {numberHundred, 100},
+	"thousand":  {numberScale, 1000},
+	"million":   {numberScale, 1000000},
+	"billion":   {numberScale, 1000000000},
+	"and":       {numberAnd, 0},
+	"a":         {numberArticle, 1}, // As in "a hundred".
+}
+
+// numberFollows lists the classes of words that can precede a word of a given
+// class in a number.
+var numberFollows = map[numberClass][]numberClass{
+	numberDigits:  {numberNone},
+	numberUnit:    {numberNone, numberTen, numberHundred, numberScale, numberAnd},
+	numberTeen:    {numberNone, numberHundred, numberScale, numberAnd},
+	numberTen:     {numberNone, numberHundred, numberScale, numberAnd},
+	numberHundred: {numberNone, numberDigits, numberUnit, numberTeen, numberTen, numberArticle},
+	numberScale:   {numberNone, numberDigits, numberUnit, numberTeen, numberTen, numberHundred, numberArticle},
+	numberAnd:     {numberHundred, numberScale},
+	numberArticle: {numberNone},
+}
+
+// numberExpr returns the regular expression matching the numbers understood
+// by parseNumber, and some more.
+func numberExpr() string {
+	var words []string
+	for w := range numberWords {
+		if w != "and" && w != "a" {
+			words = append(words, w)
+		}
+	}
+	sort.Strings(words)
+	word := `\d+|` + strings.Join(words, "|")
+	return fmt.Sprintf(`(?:a )?(?:%s)(?:[ -](?:%s|and))*`, word, word)
+}
+
+// parseNumber converts a number written in words, such as "one hundred and
+// twenty-one" or "a thousand", or in digits to its numeric form.
+func parseNumber(s string) (int, error) {
+	if strings.HasPrefix(s, "-") || strings.HasSuffix(s, "-") {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == '-'
+	})
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("empty number")
+	}
+	var total, group int
+	last, lastScale := numberNone, 0
+	for _, f := range fields {
+		w, ok := numberWords[f]
+		if !ok {
+			n, err := strconv.Atoi(f)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("%q is not a number", s)
+			}
+			w = numberWord{numberDigits, n}
+		}
+		allowed := false
+		for _, c := range numberFollows[w.class] {
+			allowed = allowed || c == last
+		}
+		if !allowed || (f == "zero" && len(fields) > 1) {
+			return 0, fmt.Errorf("%q is not a number", s)
+		}
+		switch w.class {
+		case numberDigits, numberUnit, numberTeen, numberTen, numberArticle:
+			group += w.value
+		case numberHundred:
+			if last == numberNone {
+				group = 1
+			}
+			if group >= 100 {
+				return 0, fmt.Errorf("%q is not a number", s)
+			}
+			group *= w.value
+		case numberScale:
+			if last == numberNone {
+				group = 1
+			}
+			if lastScale != 0 && w.value >= lastScale {
+				return 0, fmt.Errorf("%q is not a number", s)
+			}
+			total += group * w.value
+			group, lastScale = 0, w.value
+		}
+		last = w.class
+	}
+	if last == numberAnd || last == numberArticle {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return total + group, nil
+}
+
+// dateLayout is the layout dates are converted to, equivalent to the
+// "%Y-%m-%dT%H:%M:%SZ" format of strptime.
+const dateLayout = "2006-01-02T15:04:05Z"
+
+func convertDate(s string, now time.Time) (string, error) {
+	d, err := parseDate(s, now)
+	if err != nil {
+		return "", err
+	}
+	return d.Format(dateLayout), nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"january":   time.January,
+	"february":  time.February,
+	"march":     time.March,
+	"april":     time.April,
+	"may":       time.May,
+	"june":      time.June,
+	"july":      time.July,
+	"august":    time.August,
+	"september": time.September,
+	"october":   time.October,
+	"november":  time.November,
+	"december":  time.December,
+}
+
+// dateFillers are words that can surround a date without changing it.
+var dateFillers = map[string]bool{
+	"on":  true,
+	"the": true,
+	"of":  true,
+}
+
+// parseDate resolves a date expressed in words with respect to now, and
+// returns it at midnight UTC. It understands:
+//
+//	today, tomorrow, yesterday
+//	wednesday, this wednesday, next wednesday, last wednesday
+//	in three days, in 2 weeks, four days ago
+//	2017-05-10, may 10th, 10 may, the 10th of may 2017
+//
+// A trailing possessive, as in "tomorrow's", is ignored. Weekdays alone refer
+// to the first one from today on, "next" and "last" ones to the closest one
+// after or before today.
+func parseDate(s string, now time.Time) (time.Time, error) {
+	var words []string
+	for _, w := range strings.Fields(s) {
+		w = strings.TrimSuffix(w, "'s")
+		if !dateFillers[w] {
+			words = append(words, w)
+		}
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if len(words) == 0 {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+	switch first, last := words[0], words[len(words)-1]; {
+	case len(words) == 1 && first == "today":
+		return today, nil
+	case len(words) == 1 && first == "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	case len(words) == 1 && first == "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case len(words) == 1:
+		if wd, ok := weekdays[first]; ok {
+			return today.AddDate(0, 0, (int(wd)-int(today.Weekday())+7)%7), nil
+		}
+		if d, err := time.Parse("2006-01-02", first); err == nil {
+			return d, nil
+		}
+	case len(words) == 2 && (first == "this" || first == "next" || first == "last"):
+		wd, ok := weekdays[last]
+		if !ok {
+			break
+		}
+		diff := (int(wd) - int(today.Weekday()) + 7) % 7
+		switch {
+		case first == "next" && diff == 0:
+			diff = 7
+		case first == "last":
+			diff -= 7
+		}
+		return today.AddDate(0, 0, diff), nil
+	case first == "in" && len(words) > 2:
+		if days, ok := dateSpan(words[1:]); ok {
+			return today.AddDate(0, 0, days), nil
+		}
+	case last == "ago" && len(words) > 2:
+		if days, ok := dateSpan(words[:len(words)-1]); ok {
+			return today.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, ok := explicitDate(words, today); ok {
+		return d, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is not a date", s)
+}
+
+// dateSpan converts a span of time such as "three days" to a number of days.
+func dateSpan(words []string) (int, bool) {
+	n, err := parseNumber(strings.Join(words[:len(words)-1], " "))
+	if err != nil {
+		return 0, false
+	}
+	switch words[len(words)-1] {
+	case "day", "days":
+		return n, true
+	case "week", "weeks":
+		return 7 * n, true
+	}
+	return 0, false
+}
+
+// explicitDate converts a date composed by a month name, a day of the month
+// and an optional year, in any order. The year of today is used if the year
+// is omitted.
+func explicitDate(words []string, today time.Time) (time.Time, bool) {
+	var month time.Month
+	day, year := 0, today.Year()
+	for _, w := range words {
+		if m, ok := months[w]; ok && month == 0 {
+			month = m
+			continue
+		}
+		digits := strings.TrimRight(w, "stndrh")
+		n, err := strconv.Atoi(digits)
+		switch {
+		case err != nil || n <= 0:
+			return time.Time{}, false
+		case len(digits) == 4 && digits == w:
+			year = n
+		case len(digits) <= 2 && day == 0:
+			day = n
+		default:
+			return time.Time{}, false
+		}
+	}
+	if month == 0 || day == 0 {
+		return time.Time{}, false
+	}
+	d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if d.Day() != day {
+		// Normalized, as in february 30th.
+		return time.Time{}, false
+	}
+	return d, true
+}
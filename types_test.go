@@ -0,0 +1,114 @@
+package vikyscript
+
+import (
+	"testing"
+	"time"
+)
+
+var numberTests = []struct {
+	in  string
+	out int
+}{
+	{"0", 0},
+	{"42", 42},
+	{"zero", 0},
+	{"seven", 7},
+	{"seventeen", 17},
+	{"twenty", 20},
+	{"twenty-one", 21},
+	{"twenty one", 21},
+	{"hundred", 100},
+	{"one hundred", 100},
+	{"one hundred and five", 105},
+	{"nineteen hundred eighty-four", 1984},
+	{"two thousand and seventeen", 2017},
+	{"three hundred twelve thousand four hundred and one", 312401},
+	{"one million two thousand", 1002000},
+	{"5 thousand", 5000},
+	{"a thousand", 1000},
+	{"a hundred and two", 102},
+}
+
+var numberErrorTests = []string{
+	"",
+	"potatoes",
+	"a",
+	"a five",
+	"one thousand a hundred",
+	"one one",
+	"twenty ten",
+	"one hundred hundred",
+	"thousand million",
+	"one thousand one million",
+	"and one",
+	"one hundred and",
+	"zero one",
+	"one 5",
+	"-5",
+}
+
+func TestParseNumber(t *testing.T) {
+	for _, tt := range numberTests {
+		n, err := parseNumber(tt.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+			continue
+		}
+		if n != tt.out {
+			t.Errorf("%q: got %d expected %d", tt.in, n, tt.out)
+		}
+	}
+	for _, in := range numberErrorTests {
+		if n, err := parseNumber(in); err == nil {
+			t.Errorf("%q: expected error, got %d", in, n)
+		}
+	}
+}
+
+// dateNow is a Wednesday.
+var dateNow = time.Date(2017, time.May, 10, 18, 30, 0, 0, time.Local)
+
+var dateTests = []struct {
+	in, out string
+}{
+	{"today", "2017-05-10T00:00:00Z"},
+	{"tomorrow's", "2017-05-11T00:00:00Z"},
+	{"yesterday", "2017-05-09T00:00:00Z"},
+	{"wednesday's", "2017-05-10T00:00:00Z"},
+	{"on friday", "2017-05-12T00:00:00Z"},
+	{"monday", "2017-05-15T00:00:00Z"},
+	{"this monday", "2017-05-15T00:00:00Z"},
+	{"next wednesday", "2017-05-17T00:00:00Z"},
+	{"next thursday", "2017-05-11T00:00:00Z"},
+	{"last wednesday", "2017-05-03T00:00:00Z"},
+	{"last tuesday", "2017-05-09T00:00:00Z"},
+	{"in three days", "2017-05-13T00:00:00Z"},
+	{"in twenty-one days", "2017-05-31T00:00:00Z"},
+	{"in 2 weeks", "2017-05-24T00:00:00Z"},
+	{"a week ago", ""},
+	{"one week ago", "2017-05-03T00:00:00Z"},
+	{"2016-02-29", "2016-02-29T00:00:00Z"},
+	{"june 1st", "2017-06-01T00:00:00Z"},
+	{"the 3rd of june 2018", "2018-06-03T00:00:00Z"},
+	{"december 25", "2017-12-25T00:00:00Z"},
+	{"february 30th", ""},
+	{"30 30 june", ""},
+	{"next week", ""},
+	{"in three potatoes", ""},
+	{"potatoes", ""},
+	{"", ""},
+}
+
+func TestConvertDate(t *testing.T) {
+	for _, tt := range dateTests {
+		out, err := convertDate(tt.in, dateNow)
+		switch {
+		case tt.out == "" && err == nil:
+			t.Errorf("%q: expected error, got %s", tt.in, out)
+		case tt.out != "" && err != nil:
+			t.Errorf("%q: unexpected error: %v", tt.in, err)
+		case out != tt.out:
+			t.Errorf("%q: got %s expected %s", tt.in, out, tt.out)
+		}
+	}
+}